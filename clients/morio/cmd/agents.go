@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // morio audit
@@ -16,14 +19,16 @@ var auditCmd = &cobra.Command{
 	Long: `Invokes the audit agent.
 Any parameters after this command will be passed to auditbeat.`,
 	Args: cobra.ArbitraryArgs,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get path to auditbeat from config (and make sure it is set)
-		EnsureBeatPath("auditbeat", "audit")
+		if err := EnsureBeatPath("auditbeat", "audit"); err != nil {
+			return err
+		}
 		path := viper.GetString("agents.audit")
 
 		// Pass all arguments (after audit) to the auditbeat binary
 		// but also add the location of the Morio-specific config
-		configFlag := []string{"-c", "/etc/morio/audit/config.yml"}
+		configFlag := []string{"-c", GetConfigPath("audit/config.yml")}
 		auditbeat := exec.Command(path, append(configFlag, args...)...)
 
 		// Re-use I/O streams
@@ -33,9 +38,9 @@ Any parameters after this command will be passed to auditbeat.`,
 
 		// Run the command and capture any error
 		if err := auditbeat.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			return AgentError(err, "auditbeat failed")
 		}
+		return nil
 	},
 }
 
@@ -46,14 +51,16 @@ var logsCmd = &cobra.Command{
 	Long: `Invokes the logs agent.
 Any parameters after this command will be passed to filebeat.`,
 	Args: cobra.ArbitraryArgs,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get path to filebeat from config (and make sure it is set)
-		EnsureBeatPath("filebeat", "logs")
+		if err := EnsureBeatPath("filebeat", "logs"); err != nil {
+			return err
+		}
 		path := viper.GetString("agents.logs")
 
 		// Pass all arguments (after logs) to the filebeat binary
 		// but also add the location of the Morio-specific config
-		configFlag := []string{"-c", "/etc/morio/logs/config.yml"}
+		configFlag := []string{"-c", GetConfigPath("logs/config.yml")}
 		filebeat := exec.Command(path, append(configFlag, args...)...)
 
 		// Re-use I/O streams
@@ -63,9 +70,9 @@ Any parameters after this command will be passed to filebeat.`,
 
 		// Run the command and capture any error
 		if err := filebeat.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			return AgentError(err, "filebeat failed")
 		}
+		return nil
 	},
 }
 
@@ -76,14 +83,16 @@ var metricsCmd = &cobra.Command{
 	Long: `Invokes the metrics agent.
 Any parameters after this command will be passed to metricbeat.`,
 	Args: cobra.ArbitraryArgs,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get path to metricbeat from config (and make sure it is set)
-		EnsureBeatPath("metricbeat", "metrics")
+		if err := EnsureBeatPath("metricbeat", "metrics"); err != nil {
+			return err
+		}
 		path := viper.GetString("agents.metrics")
 
 		// Pass all arguments (after logs) to the metricbeat binary
 		// but also add the location of the Morio-specific config
-		configFlag := []string{"-c", "/etc/morio/metrics/config.yml"}
+		configFlag := []string{"-c", GetConfigPath("metrics/config.yml")}
 		metricbeat := exec.Command(path, append(configFlag, args...)...)
 
 		// Re-use I/O streams
@@ -93,9 +102,9 @@ Any parameters after this command will be passed to metricbeat.`,
 
 		// Run the command and capture any error
 		if err := metricbeat.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			return AgentError(err, "metricbeat failed")
 		}
+		return nil
 	},
 }
 
@@ -112,16 +121,25 @@ func init() {
 }
 
 // Makes sure that the path to the agent is set in the config
-func EnsureBeatPath(beat string, dataType string) {
+func EnsureBeatPath(beat string, dataType string) error {
 	key := "agents." + dataType
 	if !viper.IsSet(key) {
-		// Not set, prompt the user for the path
+		// Not set, prompt the user for the path, unless nobody is there to answer
+		if !stdinIsTerminal() {
+			return ConfigError(nil, "%s is not set in morio.yml, set it to the path to %s", key, beat)
+		}
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Please provide the path to " + beat + ": ")
-		path, _ := reader.ReadString('\n')
+		path, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return ConfigError(err, "unable to read the path to %s", beat)
+		}
 
 		// Trim newline characters from the input
-		path = path[:len(path)-1]
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return ConfigError(nil, "no path to %s given, set %s in morio.yml", beat, key)
+		}
 
 		// Set the value in Viper
 		viper.Set(key, path)
@@ -131,13 +149,13 @@ func EnsureBeatPath(beat string, dataType string) {
 			if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 				// If no config file exists, create one
 				if err := viper.SafeWriteConfig(); err != nil {
-					fmt.Println("Failed to create config file:", err)
-					os.Exit(1)
+					return ConfigError(err, "failed to create config file")
 				}
 			} else {
-				fmt.Println("Failed to write to config file:", err)
-				os.Exit(1)
+				return ConfigError(err, "failed to write to config file")
 			}
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Where the configuration is staged before it is activated
+func StagedConfigFolder() string {
+	return GetConfigPath(".staged")
+}
+
+// Where the previous generation of the configuration is kept
+// This is what 'morio template rollback' restores.
+func PreviousConfigFolder() string {
+	return GetConfigPath(".previous")
+}
+
+// Where the generation before the previous one is kept while activating
+// It is restored if the activation fails.
+func discardedConfigFolder() string {
+	return GetConfigPath(".discarded")
+}
+
+// Applies the rendered configuration
+// Every agent's configuration is staged in full before anything is activated,
+// so a template that fails to render never leaves a folder half-written or empty.
+// The staged files are then swapped in, and the configuration they replace is
+// kept as the previous generation.
+// With validate, the beats test the staged configuration before it is activated.
+// Once activated, the manifest records what was rendered, along with varsHash.
+func ApplyRenderedConfig(rendered []renderedTarget, validate bool, varsHash string) error {
+	if err := os.RemoveAll(StagedConfigFolder()); err != nil {
+		return GenericError(err, "unable to clear staged configuration")
+	}
+	defer os.RemoveAll(StagedConfigFolder())
+
+	for _, target := range rendered {
+		if err := target.Stage(); err != nil {
+			return err
+		}
+	}
+
+	if validate {
+		if err := ValidateStagedConfig(rendered); err != nil {
+			return err
+		}
+	}
+
+	if err := activateStagedConfig(rendered); err != nil {
+		return err
+	}
+
+	return WriteManifests(rendered, varsHash)
+}
+
+// Writes the rendered files of the target to the staging folder
+// For folders, the files that are not managed by 'morio template' are carried over.
+func (target renderedTarget) Stage() error {
+	staged := filepath.Join(StagedConfigFolder(), target.To)
+	if !target.Folder {
+		if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+			return GenericError(err, "unable to create %s", filepath.Dir(staged))
+		}
+	} else if err := stageFolder(target.To, staged); err != nil {
+		return err
+	}
+
+	for _, file := range target.Files {
+		path := filepath.Join(StagedConfigFolder(), file.To)
+		// Files that hold a secret are only readable by their owner
+		perm := os.FileMode(0644)
+		if file.Secret {
+			perm = 0600
+		}
+		if err := WriteFileAtomic(path, []byte(file.Content), perm); err != nil {
+			return GenericError(err, "failed to write to %s", path)
+		}
+	}
+
+	return nil
+}
+
+// Creates a staging folder, carrying over files not managed by 'morio template'
+func stageFolder(folder string, staged string) error {
+	live := GetConfigPath(folder)
+	info, err := os.Stat(live)
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.MkdirAll(staged, 0755)
+	}
+	if err != nil {
+		return ConfigError(err, "unable to read folder at %s", live)
+	}
+	if err := os.MkdirAll(staged, info.Mode().Perm()); err != nil {
+		return GenericError(err, "unable to create %s", staged)
+	}
+
+	managed, err := RenderedFileList(folder)
+	if err != nil {
+		return err
+	}
+	skip := make(map[string]bool)
+	for _, file := range managed {
+		skip[file] = true
+	}
+	entries, err := os.ReadDir(live)
+	if err != nil {
+		return ConfigError(err, "unable to read files from folder at %s", live)
+	}
+	for _, entry := range entries {
+		if skip[entry.Name()] {
+			continue
+		}
+		if err := copyEntry(filepath.Join(live, entry.Name()), filepath.Join(staged, entry.Name())); err != nil {
+			return GenericError(err, "unable to stage %s", filepath.Join(live, entry.Name()))
+		}
+	}
+
+	return nil
+}
+
+// Copies a file, folder, or symlink
+func copyEntry(from string, to string) error {
+	info, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(from)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, to)
+	case info.IsDir():
+		return os.CopyFS(to, os.DirFS(from))
+	default:
+		data, err := os.ReadFile(from)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(to, data, info.Mode().Perm())
+	}
+}
+
+// Swaps the staged configuration in
+// If this fails halfway, the targets that were already swapped are restored.
+func activateStagedConfig(rendered []renderedTarget) error {
+	// Keep the previous generation around until we are done
+	if err := os.RemoveAll(discardedConfigFolder()); err != nil {
+		return GenericError(err, "unable to clear %s", discardedConfigFolder())
+	}
+	if err := renameIfExists(PreviousConfigFolder(), discardedConfigFolder()); err != nil {
+		return GenericError(err, "unable to move the previous configuration aside")
+	}
+
+	var activated []renderedTarget
+	for _, target := range rendered {
+		if err := swapGeneration(filepath.Join(StagedConfigFolder(), target.To), GetConfigPath(target.To), filepath.Join(PreviousConfigFolder(), target.To)); err != nil {
+			restoreActivatedConfig(activated)
+			return GenericError(err, "unable to activate %s, the configuration was restored", GetConfigPath(target.To))
+		}
+		activated = append(activated, target)
+	}
+	os.RemoveAll(discardedConfigFolder())
+
+	for _, target := range rendered {
+		for _, file := range target.Files {
+			fmt.Println(GetConfigPath(file.To))
+		}
+	}
+
+	return nil
+}
+
+// Puts back the configuration that was in place before activating
+func restoreActivatedConfig(activated []renderedTarget) {
+	for i := len(activated) - 1; i >= 0; i-- {
+		live := GetConfigPath(activated[i].To)
+		previous := filepath.Join(PreviousConfigFolder(), activated[i].To)
+		if _, err := os.Lstat(previous); err == nil {
+			exchangePaths(previous, live)
+		} else {
+			os.RemoveAll(live)
+		}
+	}
+	os.RemoveAll(PreviousConfigFolder())
+	renameIfExists(discardedConfigFolder(), PreviousConfigFolder())
+}
+
+// Moves the next generation of a file or folder in place,
+// and the current one to where the previous generation is kept
+func swapGeneration(next string, live string, previous string) error {
+	if err := os.MkdirAll(filepath.Dir(previous), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(live); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(next, live); err != nil {
+			return err
+		}
+		return syncDir(filepath.Dir(live))
+	}
+	if err := exchangePaths(next, live); err != nil {
+		return err
+	}
+	if err := os.Rename(next, previous); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(live))
+}
+
+// Swaps two files or folders through a temporary name
+func exchangePathsByRename(a string, b string) error {
+	tmp := b + ".swap"
+	if err := os.Rename(b, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(a, b); err != nil {
+		os.Rename(tmp, b)
+		return err
+	}
+
+	return os.Rename(tmp, a)
+}
+
+// Renames a file or folder, unless it does not exist
+func renameIfExists(from string, to string) error {
+	err := os.Rename(from, to)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Swaps in the previous generation of the configuration
+// The configuration it replaces becomes the previous generation, so running
+// this twice undoes the rollback.
+func RollbackConfig(agents []string) error {
+	if len(agents) == 0 {
+		agents = []string{"audit", "metrics", "logs"}
+	}
+	for _, agent := range agents {
+		if !isAgent(agent) {
+			return GenericError(nil, "unknown agent %s, use one of audit, logs, or metrics", agent)
+		}
+		if _, err := os.Stat(filepath.Join(PreviousConfigFolder(), agent)); err != nil {
+			fmt.Printf("There is no previous configuration for %s\n", agent)
+			continue
+		}
+		for _, target := range renderTargets {
+			if target.Agent != agent {
+				continue
+			}
+			previous := filepath.Join(PreviousConfigFolder(), target.To)
+			if _, err := os.Lstat(previous); err != nil {
+				continue
+			}
+			live := GetConfigPath(target.To)
+			var err error
+			if _, statErr := os.Lstat(live); errors.Is(statErr, fs.ErrNotExist) {
+				err = os.Rename(previous, live)
+			} else {
+				err = exchangePaths(previous, live)
+			}
+			if err != nil {
+				return GenericError(err, "unable to roll back %s", live)
+			}
+		}
+		if err := rollbackManifest(agent); err != nil {
+			return GenericError(err, "unable to roll back the manifest of %s", agent)
+		}
+		fmt.Printf("Rolled back the %s configuration\n", agent)
+	}
+	fmt.Println("Restart the agents to use the restored configuration.")
+
+	return nil
+}
+
+func isAgent(name string) bool {
+	for _, target := range renderTargets {
+		if target.Agent == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Returns the render target that renders to a path
+func testRenderTarget(t *testing.T, to string) renderTarget {
+	t.Helper()
+	for _, target := range renderTargets {
+		if target.To == to {
+			return target
+		}
+	}
+	t.Fatalf("no render target for %s", to)
+
+	return renderTarget{}
+}
+
+// Renders the logs configuration and one module in memory
+// The templates are written too, as they are in an installation.
+func testRenderedLogs(t *testing.T, content string, secret bool) []renderedTarget {
+	t.Helper()
+	writeTestFile(t, "logs/config-template.yml", "output: {}\n")
+	writeTestFile(t, "logs/module-templates.d/nginx.yml", "- type: filestream\n")
+
+	return []renderedTarget{
+		{
+			renderTarget: testRenderTarget(t, "logs/config.yml"),
+			Files:        []renderedFile{{From: "logs/config-template.yml", To: "logs/config.yml", Content: content, Secret: secret}},
+		},
+		{
+			renderTarget: testRenderTarget(t, "logs/modules.d"),
+			Files:        []renderedFile{{From: "logs/module-templates.d/nginx.yml", To: "logs/modules.d/nginx.yml", Content: content}},
+		},
+	}
+}
+
+func TestApplyAndRollback(t *testing.T) {
+	useTestRoot(t)
+	// Files in a managed folder that morio does not render are carried over
+	writeTestFile(t, "logs/modules.d/custom.conf", "custom")
+
+	if err := ApplyRenderedConfig(testRenderedLogs(t, "first", false), false, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyRenderedConfig(testRenderedLogs(t, "second", false), false, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"logs/config.yml", "logs/modules.d/nginx.yml"} {
+		if got := readTestFile(t, path); got != "second" {
+			t.Errorf("%s: got %q, want the second generation", path, got)
+		}
+		if got := readTestFile(t, filepath.Join(".previous", path)); got != "first" {
+			t.Errorf("previous %s: got %q, want the first generation", path, got)
+		}
+	}
+	if got := readTestFile(t, "logs/modules.d/custom.conf"); got != "custom" {
+		t.Errorf("unmanaged file: got %q, want it carried over", got)
+	}
+	if _, err := os.Stat(StagedConfigFolder()); !os.IsNotExist(err) {
+		t.Errorf("the staging folder should be removed")
+	}
+
+	// Rolling back swaps the generations, so doing it twice restores the second one
+	for _, want := range []string{"first", "second"} {
+		if err := RollbackConfig([]string{"logs"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{"logs/config.yml", "logs/modules.d/nginx.yml"} {
+			if got := readTestFile(t, path); got != want {
+				t.Errorf("%s after rollback: got %q, want %q", path, got, want)
+			}
+		}
+		manifest, err := ReadManifest("logs")
+		if err != nil || manifest == nil {
+			t.Fatalf("no manifest after rollback: %v", err)
+		}
+		if got := manifest.Files[0].Hash; got != sha256Hex(want) {
+			t.Errorf("manifest after rollback: got hash %s, want the one of %q", got, want)
+		}
+	}
+}
+
+func TestApplySecretFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes do not apply on Windows")
+	}
+	useTestRoot(t)
+	if err := ApplyRenderedConfig(testRenderedLogs(t, "password: hunter2", true), false, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]os.FileMode{"logs/config.yml": 0600, "logs/modules.d/nginx.yml": 0644} {
+		info, err := os.Stat(GetConfigPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s: got mode %o, want %o", path, info.Mode().Perm(), want)
+		}
+	}
+}
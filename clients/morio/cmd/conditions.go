@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The conditions that a template can set under moriodata.when
+// A template is only rendered when all of its conditions hold. A condition
+// with a list of values holds when any of them matches.
+var templateConditions = map[string]func(string) bool{
+	"os": func(name string) bool {
+		return strings.EqualFold(GetHostFacts()[HostFactPrefix+"OS"], name)
+	},
+	"os_family": func(family string) bool {
+		return strings.EqualFold(GetHostFacts()[HostFactPrefix+"OS_FAMILY"], family)
+	},
+	"file_exists": func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && !info.IsDir()
+	},
+	"dir_exists": func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && info.IsDir()
+	},
+	"systemd_unit": systemdUnitExists,
+	"binary": func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	},
+}
+
+// Where systemd looks for unit files
+var systemdUnitFolders = []string{
+	"/etc/systemd/system",
+	"/run/systemd/system",
+	"/usr/lib/systemd/system",
+	"/lib/systemd/system",
+}
+
+// Checks whether a systemd unit is installed
+// A unit without a suffix is taken to be a service.
+func systemdUnitExists(unit string) bool {
+	if filepath.Ext(unit) == "" {
+		unit += ".service"
+	}
+	for _, folder := range systemdUnitFolders {
+		if _, err := os.Stat(filepath.Join(folder, unit)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parses moriodata.when into a map of conditions and their values
+func ParseConditions(when interface{}) (map[string][]string, error) {
+	if when == nil {
+		return nil, nil
+	}
+	spec, ok := when.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("moriodata.when is not a map")
+	}
+	conditions := make(map[string][]string, len(spec))
+	for _, name := range sortedKeys(spec) {
+		if _, known := templateConditions[name]; !known {
+			return nil, fmt.Errorf("unknown condition %s in moriodata.when, use one of %s", name, strings.Join(sortedKeys(templateConditions), ", "))
+		}
+		switch value := spec[name].(type) {
+		case []interface{}:
+			for _, item := range value {
+				conditions[name] = append(conditions[name], fmt.Sprint(item))
+			}
+		case map[string]interface{}, nil:
+			return nil, fmt.Errorf("condition %s in moriodata.when needs a value or a list of values", name)
+		default:
+			conditions[name] = []string{fmt.Sprint(value)}
+		}
+	}
+
+	return conditions, nil
+}
+
+// Returns the first condition of a template that does not hold
+// This is an empty string when all conditions hold, or there are none.
+func UnmetCondition(moriodata map[string]interface{}) (string, error) {
+	conditions, err := ParseConditions(moriodata["when"])
+	if err != nil {
+		return "", err
+	}
+	for _, name := range sortedKeys(conditions) {
+		if !ConditionHolds(name, conditions[name]) {
+			return FormatCondition(name, conditions[name]), nil
+		}
+	}
+
+	return "", nil
+}
+
+// Checks whether a condition holds for any of its values
+func ConditionHolds(name string, values []string) bool {
+	for _, value := range values {
+		if templateConditions[name](value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Formats a condition as name=value, or name=value1,value2 for a list
+func FormatCondition(name string, values []string) string {
+	return name + "=" + strings.Join(values, ",")
+}
+
+// Returns the first condition of a template file that does not hold
+func TemplateUnmetCondition(from string) (string, error) {
+	moriodata, err := TemplateDocsAsYaml(from)
+	if err != nil {
+		return "", err
+	}
+	condition, err := UnmetCondition(moriodata)
+	if err != nil {
+		return "", TemplateError(err, "invalid conditions in %s", GetConfigPath(from))
+	}
+
+	return condition, nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commands that are annotated with this hold the config lock while they run
+// This makes sure two morio processes do not change the configuration at once.
+const mutatingAnnotation string = "morio.mutating"
+
+var mutating = map[string]string{mutatingAnnotation: "true"}
+
+// The config lock that is held by this process (if any)
+var configLock *os.File
+
+// Location of the config lock
+func ConfigLockFile() string {
+	return GetConfigPath(".morio.lock")
+}
+
+// Acquires the config lock for commands that change the configuration
+// Dry runs do not change anything, so they do not need the lock.
+func lockForCommand(cmd *cobra.Command, args []string) error {
+	if cmd.Annotations[mutatingAnnotation] != "true" {
+		return nil
+	}
+	for _, flag := range []string{"dry-run", "diff"} {
+		if preview, err := cmd.Flags().GetBool(flag); err == nil && preview {
+			return nil
+		}
+	}
+
+	return AcquireConfigLock(viper.GetDuration("lock-timeout"))
+}
+
+// Acquires the (advisory) config lock
+// If another process holds the lock, this retries until the timeout expires.
+// With a zero timeout, this fails right away.
+func AcquireConfigLock(timeout time.Duration) error {
+	if configLock != nil {
+		return nil
+	}
+	file, err := os.OpenFile(ConfigLockFile(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return GenericError(err, "unable to open the config lock")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err = lockFile(file)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLocked) {
+			file.Close()
+			return GenericError(err, "unable to acquire the config lock")
+		}
+		if !time.Now().Before(deadline) {
+			owner := lockOwner(file)
+			file.Close()
+			return BusyError(nil, "the configuration is locked by PID %s, try again later or pass --lock-timeout", owner)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Record our PID, so others can tell who holds the lock
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	file.Sync()
+	configLock = file
+
+	return nil
+}
+
+// Releases the config lock, if this process holds it
+func ReleaseConfigLock() {
+	if configLock == nil {
+		return
+	}
+	configLock.Truncate(0)
+	unlockFile(configLock)
+	configLock.Close()
+	configLock = nil
+}
+
+// Reads the PID of the process that holds the lock
+func lockOwner(file *os.File) string {
+	file.Seek(0, io.SeekStart)
+	pid, err := io.ReadAll(file)
+	if err != nil || len(strings.TrimSpace(string(pid))) == 0 {
+		return "unknown"
+	}
+
+	return strings.TrimSpace(string(pid))
+}
+
+// Returned by lockFile when another process holds the lock
+var errLocked = fmt.Errorf("locked by another process")
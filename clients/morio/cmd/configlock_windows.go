@@ -0,0 +1,29 @@
+//go:build windows
+
+package cmd
+
+import (
+	"errors"
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+func lockFile(file *os.File) error {
+	overlapped := new(windows.Overlapped)
+	err := windows.LockFileEx(
+		windows.Handle(file.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, overlapped,
+	)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLocked
+	}
+
+	return err
+}
+
+func unlockFile(file *os.File) error {
+	overlapped := new(windows.Overlapped)
+
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, overlapped)
+}
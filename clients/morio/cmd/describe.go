@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Prints the value, provenance, declarations, and usage of a var
+func DescribeVar(name string) error {
+	value, source := LookupVar(name)
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		return err
+	}
+	decls := declarations[name]
+	consumers, err := VarConsumers(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Name:   " + name)
+	if source == VarSourceUnset {
+		fmt.Println("Value:  (not set)")
+	} else {
+		fmt.Println("Value:  " + DisplayValue(value))
+	}
+	fmt.Println("Source: " + describeVarSource(name, source, decls))
+	for _, decl := range decls {
+		if decl.Info != "" {
+			fmt.Println("Info:   " + decl.Info)
+			break
+		}
+	}
+
+	if len(decls) == 0 {
+		fmt.Println("Declared in: (not declared)")
+	} else {
+		fmt.Println("Declared in:")
+		for _, decl := range decls {
+			fmt.Printf("  - %s (type: %s", decl.Source, decl.Type)
+			if decl.HasDflt && decl.Type != "secret" {
+				fmt.Printf(", dflt: %v", decl.Dflt)
+			}
+			if decl.Required {
+				fmt.Print(", required")
+			}
+			fmt.Println(")")
+		}
+	}
+
+	if len(consumers) == 0 {
+		fmt.Println("Used by: (not used)")
+	} else {
+		fmt.Println("Used by:")
+		for _, file := range consumers {
+			fmt.Printf("  - %s (from %s)\n", GetConfigPath(file.To), GetConfigPath(file.From))
+		}
+	}
+
+	return nil
+}
+
+// Explains where the value of a var comes from
+// Default vars are written by 'morio template' from the global vars first,
+// and then from the module templates, so the last declaration with a dflt wins.
+func describeVarSource(name string, source string, decls []VarDeclaration) string {
+	switch source {
+	case VarSourceLocked:
+		return "locked (" + LockedVarFolder() + ")"
+	case VarSourceEnv:
+		return "env (" + EnvVarPrefix + name + ")"
+	case VarSourceRuntime:
+		return "runtime (" + RuntimeVarFolder() + ")"
+	case VarSourceFile:
+		return "vars file (" + viper.GetString("vars-file") + ")"
+	case VarSourceProfile:
+		return "profile (" + ActiveProfile() + ")"
+	}
+	if source != VarSourceDefault {
+		return source
+	}
+	for i := len(decls) - 1; i >= 0; i-- {
+		if decls[i].HasDflt {
+			if decls[i].Source == GetConfigPath("global-vars.yml") {
+				return "global default (" + decls[i].Source + ")"
+			}
+			return "template default (" + decls[i].Source + ")"
+		}
+	}
+
+	return "default"
+}
+
+// Lists the (enabled) templates that use a var, along with the file they render to
+// A var that is used in a partial, or in global processors, is used by every
+// file they end up in. These are listed with the partial or processors as
+// where they come from.
+func VarConsumers(name string) ([]renderFile, error) {
+	processors, err := processorsUsingVar(name)
+	if err != nil {
+		return nil, err
+	}
+	var consumers []renderFile
+	for _, target := range renderTargets {
+		files, err := target.Files()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			template, err := os.ReadFile(GetConfigPath(file.From))
+			if err != nil {
+				return nil, ConfigError(err, "cannot read template file")
+			}
+			if TemplateUsesVar(template, name) {
+				consumers = append(consumers, file)
+			}
+			// A partial that is missing fails the render, not this
+			partials, _ := TemplatePartials(string(template))
+			for _, partialName := range partials {
+				partial, err := ReadPartial(partialName)
+				if err == nil && TemplateUsesVar([]byte(partial), name) {
+					consumers = append(consumers, renderFile{From: filepath.Join(partialsFolder, partialName+".yml"), To: file.To})
+				}
+			}
+			if !target.Input {
+				continue
+			}
+			for _, set := range processors {
+				if set.AppliesTo(target.Agent, ModuleNameFromFile(file.From)) {
+					consumers = append(consumers, renderFile{From: filepath.Join("processors.d", set.Name+".yml"), To: file.To})
+				}
+			}
+		}
+	}
+
+	return consumers, nil
+}
+
+// Checks whether a template uses a var, with a mustache tag or a Go template field
+// This matches all tag types, like {|NAME|}, {|{NAME}|}, {|#NAME|}, and {|^NAME|}
+func TemplateUsesVar(template []byte, name string) bool {
+	tag := regexp.MustCompile(`\{\|\s*[#^/&{]?\s*` + regexp.QuoteMeta(name) + `\s*\}?\s*\|\}`)
+	// Go templates use vars as {{ .NAME }}
+	field := regexp.MustCompile(`\{\{[^}]*\.` + regexp.QuoteMeta(name) + `\b[^}]*\}\}`)
+
+	return tag.Match(template) || field.Match(template)
+}
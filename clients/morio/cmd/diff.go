@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pmezard/go-difflib/difflib"
+	"io/fs"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// How a config file would change
+const (
+	ConfigAdded   string = "+"
+	ConfigChanged string = "~"
+	ConfigRemoved string = "-"
+)
+
+// A config file that would change when it is templated out
+type configChange struct {
+	Agent  string
+	To     string
+	Change string
+	Old    string
+	New    string
+	// Whether the old or new content holds a secret
+	Secret bool
+}
+
+// Compares the rendered config to what is on disk
+func ConfigChanges(rendered []renderedTarget) ([]configChange, error) {
+	var changes []configChange
+	for _, target := range rendered {
+		seen := make(map[string]bool)
+		for _, file := range target.Files {
+			seen[file.To] = true
+			old, exists, err := readConfigFile(file.To)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				changes = append(changes, configChange{Agent: target.Agent, To: file.To, Change: ConfigAdded, New: file.Content, Secret: file.Secret})
+			} else if old != file.Content {
+				secret := file.Secret || isPrivateConfigFile(file.To)
+				changes = append(changes, configChange{Agent: target.Agent, To: file.To, Change: ConfigChanged, Old: old, New: file.Content, Secret: secret})
+			}
+		}
+		if !target.Folder {
+			continue
+		}
+		// Files that are no longer rendered will be removed
+		files, err := RenderedFileList(target.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			to := target.To + "/" + file
+			if seen[to] {
+				continue
+			}
+			old, _, err := readConfigFile(to)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, configChange{Agent: target.Agent, To: to, Change: ConfigRemoved, Old: old, Secret: isPrivateConfigFile(to)})
+		}
+	}
+
+	return changes, nil
+}
+
+// Reads a config file relative to the installation root
+// A file that does not exist is not an error.
+func readConfigFile(to string) (string, bool, error) {
+	data, err := os.ReadFile(GetConfigPath(to))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, ConfigError(err, "unable to read %s", GetConfigPath(to))
+	}
+
+	return string(data), true, nil
+}
+
+// Whether a config file is only readable by its owner
+// That is how files that hold a secret are written, so an old version of the
+// file can hold a secret that has since been changed.
+func isPrivateConfigFile(to string) bool {
+	info, err := os.Stat(GetConfigPath(to))
+	if err != nil || runtime.GOOS == "windows" {
+		return false
+	}
+
+	return info.Mode().Perm()&0077 == 0
+}
+
+// Prints how the config would change, without changing anything
+// With showDiff, a unified diff is shown for every file, with secrets redacted.
+// Files that hold a secret are listed without their diff.
+func PreviewConfigChanges(rendered []renderedTarget, showDiff bool, secrets []string) error {
+	changes, err := ConfigChanges(rendered)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+
+	agent := ""
+	for _, change := range changes {
+		if change.Agent != agent {
+			agent = change.Agent
+			fmt.Printf("# %s\n", agent)
+		}
+		if !showDiff {
+			fmt.Printf("  %s %s\n", change.Change, GetConfigPath(change.To))
+			continue
+		}
+		diff, err := PreviewConfigDiff(change, secrets)
+		if err != nil {
+			return GenericError(err, "unable to diff %s", GetConfigPath(change.To))
+		}
+		fmt.Print(diff)
+	}
+	printPartialUse(changes, rendered)
+
+	return ChangesError(nil, "%d config file(s) would change", len(changes))
+}
+
+// Returns the diff to preview for a config change
+// Secrets are redacted, but a file that holds a secret can also hold an old
+// value of it, which is no longer known. So its diff is not shown at all.
+func PreviewConfigDiff(change configChange, secrets []string) (string, error) {
+	if change.Secret {
+		return fmt.Sprintf("  %s %s (holds secrets, diff not shown)\n", change.Change, GetConfigPath(change.To)), nil
+	}
+	diff, err := UnifiedConfigDiff(change)
+	if err != nil {
+		return "", err
+	}
+
+	return RedactSecrets(diff, secrets), nil
+}
+
+// Returns a unified diff for a config change
+func UnifiedConfigDiff(change configChange) (string, error) {
+	from, to := GetConfigPath(change.To), GetConfigPath(change.To)
+	switch change.Change {
+	case ConfigAdded:
+		from = "/dev/null"
+	case ConfigRemoved:
+		to = "/dev/null"
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(change.Old),
+		B:        difflib.SplitLines(change.New),
+		FromFile: from,
+		ToFile:   to,
+		Context:  3,
+	})
+}
+
+// Replaces revealed secrets in text with the redacted value
+func RedactSecrets(text string, secrets []string) string {
+	// Longer secrets go first, so a secret that contains another one is redacted whole
+	sorted := append([]string(nil), secrets...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	for _, secret := range sorted {
+		text = strings.ReplaceAll(text, secret, RedactedValue)
+	}
+
+	return text
+}
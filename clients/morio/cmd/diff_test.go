@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	secrets := []string{"hunter2", `hunter2&<x`}
+	text := "a: hunter2&<x\nb: hunter2\n"
+	want := "a: ***\nb: ***\n"
+	if got := RedactSecrets(text, secrets); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// The old value of a rotated secret is no longer known, so it cannot be redacted
+func TestPreviewConfigDiffSecret(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes do not apply on Windows")
+	}
+	useTestRoot(t)
+	writeTestFile(t, "logs/config.yml", "password: old-secret\n")
+	if err := os.Chmod(GetConfigPath("logs/config.yml"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rendered := testRenderedLogs(t, "password: new-secret\n", false)
+
+	changes, err := ConfigChanges(rendered[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !changes[0].Secret {
+		t.Fatalf("got %+v, want one change that holds secrets", changes)
+	}
+	for _, secret := range []bool{true, false} {
+		change := changes[0]
+		change.Secret = secret
+		diff, err := PreviewConfigDiff(change, []string{"new-secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret && (strings.Contains(diff, "old-secret") || strings.Contains(diff, "new-secret")) {
+			t.Errorf("got %q, want no secrets", diff)
+		}
+		if !secret && (!strings.Contains(diff, "old-secret") || strings.Contains(diff, "new-secret")) {
+			t.Errorf("got %q, want only the known secret redacted", diff)
+		}
+	}
+}
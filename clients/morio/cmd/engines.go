@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	gotemplate "text/template"
+)
+
+// Template engines that a template can select with moriodata.engine
+const (
+	EngineMustache string = "mustache"
+	EngineGo       string = "go"
+)
+
+// The moriodata item of a template, which is always the first in the list
+var moriodataStart = regexp.MustCompile(`^-\s+moriodata:`)
+
+// Returns the moriodata block of a template, or an empty string if it has none
+func moriodataBlock(template string) string {
+	var block []string
+	for _, line := range strings.Split(template, "\n") {
+		if block == nil {
+			if moriodataStart.MatchString(line) {
+				block = append(block, line)
+			}
+			continue
+		}
+		// The block ends at the next item in the list
+		if strings.HasPrefix(line, "-") || (line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "#")) {
+			break
+		}
+		block = append(block, line)
+	}
+
+	return strings.Join(block, "\n")
+}
+
+// Returns the part of a template to render when we only need its moriodata
+// Go templates fail on things like indexing a list that is not set yet, so
+// only their moriodata block is rendered.
+func moriodataSource(template string) string {
+	if engine, err := TemplateEngine(template); err == nil && engine == EngineGo {
+		return moriodataBlock(template)
+	}
+
+	return template
+}
+
+// Returns the engine that a template should be rendered with
+// We cannot render the template to find out, so the moriodata block is
+// parsed on its own. Mustache is the default.
+func TemplateEngine(template string) (string, error) {
+	block := moriodataBlock(template)
+	if block == "" {
+		return EngineMustache, nil
+	}
+
+	var items []map[string]map[string]interface{}
+	if err := yaml.Unmarshal([]byte(block), &items); err != nil || len(items) == 0 {
+		return EngineMustache, nil
+	}
+	engine, _ := items[0]["moriodata"]["engine"].(string)
+	switch engine {
+	case "", EngineMustache:
+		return EngineMustache, nil
+	case EngineGo:
+		return EngineGo, nil
+	}
+
+	return "", fmt.Errorf("unsupported template engine '%s', use %s or %s", engine, EngineMustache, EngineGo)
+}
+
+// Renders a template with the engine it selects
+// In strict mode, using a var that is not defined is an error.
+func RenderTemplate(template string, from string, context map[string]interface{}, strict bool) (string, error) {
+	engine, err := TemplateEngine(template)
+	if err != nil {
+		return "", err
+	}
+	if engine == EngineGo {
+		return RenderGoTemplate(template, from, context, strict)
+	}
+
+	return RenderMustache(template, from, context, strict)
+}
+
+// The functions that Go templates can use
+var goTemplateFuncs = gotemplate.FuncMap{
+	// {{ .NAME | default "value" }}
+	"default": func(dflt interface{}, value interface{}) interface{} {
+		if isEmptyValue(value) {
+			return dflt
+		}
+		return value
+	},
+	// {{ .PATHS | join "," }}
+	"join": func(sep string, value interface{}) string {
+		var items []string
+		for _, item := range listItems(value) {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, sep)
+	},
+	// {{ .PATHS | toYaml }}
+	"toYaml": func(value interface{}) (string, error) {
+		switch v := value.(type) {
+		case renderList:
+			value = []interface{}(v)
+		case renderMap:
+			value = map[string]interface{}(v)
+		}
+		data, err := yaml.Marshal(value)
+		return strings.TrimSuffix(string(data), "\n"), err
+	},
+	// {{ .NAME | quote }}
+	"quote": func(value interface{}) string {
+		if value == nil {
+			return `""`
+		}
+		return strconv.Quote(fmt.Sprint(value))
+	},
+	// {{ env "HOME" }}
+	"env": os.Getenv,
+	// {{ hostfact "FQDN" }} or {{ hostfact "MORIO_HOST_FQDN" }}
+	"hostfact": func(name string) string {
+		if !IsHostFact(name) {
+			name = HostFactPrefix + name
+		}
+		return GetHostFacts()[name]
+	},
+}
+
+// Checks whether a value is empty, like an unset var, false, 0, or an empty list
+func isEmptyValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+
+	return v.IsZero()
+}
+
+// Returns the items of a list, or the value itself if it is not a list
+func listItems(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case renderList:
+		return v
+	case []interface{}:
+		return v
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items
+	}
+
+	return []interface{}{value}
+}
+
+var goMissingKeyPattern = regexp.MustCompile(`template: (.*):(\d+):\d+: executing .* map has no entry for key "([^"]*)"`)
+
+// Renders a template with Go's text/template
+// Vars are used as {{ .NAME }}. Text/template fails on a var that is not
+// defined, so it is defined as an empty string and the template is rendered
+// again, which is how mustache renders it. In strict mode, these vars are
+// collected along the way, so they can be reported at once.
+func RenderGoTemplate(template string, from string, context map[string]interface{}, strict bool) (string, error) {
+	tmpl, err := gotemplate.New(from).Option("missingkey=error").Funcs(goTemplateFuncs).Parse(template)
+	if err != nil {
+		return "", err
+	}
+	// Partials are added as named templates
+	partials, err := TemplatePartials(template)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range partials {
+		partial, err := ReadPartial(name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := tmpl.New(name).Parse(partial); err != nil {
+			return "", err
+		}
+	}
+
+	undefined := &UndefinedVarsError{}
+	for {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, context)
+		match := goMissingKeyPattern.FindStringSubmatch(fmt.Sprint(err))
+		if match == nil {
+			if err == nil && len(undefined.Vars) > 0 {
+				return "", undefined
+			}
+			return buf.String(), err
+		}
+		if strict {
+			// The var is used in the template itself, or in one of its partials
+			file := GetConfigPath(from)
+			if match[1] != from {
+				file = PartialPath(match[1])
+			}
+			line, _ := strconv.Atoi(match[2])
+			undefined.Vars = append(undefined.Vars, undefinedVar{File: file, Line: line, Name: match[3]})
+		}
+		if _, seen := context[match[3]]; seen {
+			// This is a missing key of a map var, rather than a var
+			if strict {
+				return "", undefined
+			}
+			return "", err
+		}
+		context = withVar(context, match[3], "")
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestRenderGoTemplateUndefined(t *testing.T) {
+	template := "a: {{ .X }}\nb: {{ .Y | default \"dflt\" }}\n{{ if .Z }}c: 1\n{{ end }}d: <no value>\n"
+	got, err := RenderGoTemplate(template, "test.yml", map[string]interface{}{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Text that looks like what text/template prints for a missing key is left alone
+	want := "a: \nb: dflt\nd: <no value>\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, err = RenderGoTemplate(template, "test.yml", map[string]interface{}{}, true)
+	undefined, ok := err.(*UndefinedVarsError)
+	if !ok {
+		t.Fatalf("got %v, want undefined vars", err)
+	}
+	if len(undefined.Vars) != 3 {
+		t.Errorf("got %v, want X, Y, and Z", undefined.Vars)
+	}
+}
+
+// Named templates that a template defines itself are not partials
+func TestRenderGoTemplateDefine(t *testing.T) {
+	useTestRoot(t)
+	template := "{{ define \"input\" }}- type: {{ . }}\n{{ end }}{{ template \"input\" \"filestream\" }}{{ block \"extra\" . }}{{ end }}"
+	got, err := RenderGoTemplate(template, "test.yml", map[string]interface{}{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- type: filestream\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
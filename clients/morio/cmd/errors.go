@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Exit codes returned by the morio client
+// These are stable, so automation can branch on them
+const (
+	ExitOK               int = 0
+	ExitFailure          int = 1
+	ExitConfigMissing    int = 2
+	ExitTemplateError    int = 3
+	ExitAgentFailure     int = 4
+	ExitPermissionDenied int = 5
+	ExitInvalidVar       int = 6
+	ExitVarLocked        int = 7
+	ExitBusy             int = 8
+	ExitChanges          int = 9
+)
+
+// MorioError is an error that carries the exit code it should result in
+type MorioError struct {
+	Code int
+	Msg  string
+	Err  error
+}
+
+func (e *MorioError) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	if e.Msg == "" {
+		return e.Err.Error()
+	}
+
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *MorioError) Unwrap() error {
+	return e.Err
+}
+
+// Wraps an error that is caused by missing or unreadable configuration
+func ConfigError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitConfigMissing, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Wraps an error that is caused by a template that cannot be rendered
+func TemplateError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitTemplateError, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Wraps an error that is caused by an agent (or its service)
+func AgentError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitAgentFailure, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Wraps an error that is caused by a var that does not match its declaration
+func ValidationError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitInvalidVar, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Wraps an error that is caused by a change to a locked var
+func LockedError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitVarLocked, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Wraps an error that is caused by another morio process holding the config lock
+func BusyError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitBusy, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Signals that the configuration on disk differs from what is rendered, or from the manifest
+func ChangesError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitChanges, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Wraps any other error
+func GenericError(err error, format string, args ...interface{}) error {
+	return &MorioError{Code: ExitFailure, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// Returns the exit code for an error
+// Permission errors always result in ExitPermissionDenied, regardless
+// of how they were wrapped, since that is what the operator needs to fix.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return ExitPermissionDenied
+	}
+	var morioErr *MorioError
+	if errors.As(err, &morioErr) {
+		return morioErr.Code
+	}
+
+	return ExitFailure
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package cmd
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+)
+
+// Swaps two files or folders in one atomic operation
+// Not all filesystems support this, in which case we fall back to renames.
+func exchangePaths(a string, b string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+		return exchangePathsByRename(a, b)
+	}
+
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package cmd
+
+// Swaps two files or folders
+// This platform cannot do it atomically, so it takes three renames.
+func exchangePaths(a string, b string) error {
+	return exchangePathsByRename(a, b)
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"time"
+)
+
+// A single change to a (custom) var
+// Old and New are nil when the var was not set before or after the change.
+type JournalEntry struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Name string    `json:"name"`
+	Old  *string   `json:"old"`
+	New  *string   `json:"new"`
+}
+
+// Location of the var journal
+func VarJournalFile() string {
+	return GetConfigPath("vars.journal")
+}
+
+// Returns the user that invoked morio
+// When running under sudo, this includes the user that invoked sudo.
+func invokingUser() string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" && sudoUser != name {
+		name += " (sudo: " + sudoUser + ")"
+	}
+
+	return name
+}
+
+// Appends a change to the var journal
+func JournalVarChange(name string, old *string, new *string) error {
+	entry := JournalEntry{
+		Time: time.Now().UTC(),
+		User: invokingUser(),
+		Name: name,
+		Old:  old,
+		New:  new,
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return GenericError(err, "unable to journal change to var %s", name)
+	}
+
+	file, err := os.OpenFile(VarJournalFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return GenericError(err, "unable to journal change to var %s", name)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return GenericError(err, "unable to journal change to var %s", name)
+	}
+
+	return file.Sync()
+}
+
+// Reads the var journal, optionally only for one var
+func ReadVarJournal(name string) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	file, err := os.Open(VarJournalFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, ConfigError(err, "unable to read the var journal")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, ConfigError(err, "the var journal is corrupt")
+		}
+		if name == "" || entry.Name == name {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ConfigError(err, "unable to read the var journal")
+	}
+
+	return entries, nil
+}
+
+// Formats a journaled value for display
+func journalValue(value *string) string {
+	if value == nil {
+		return "(unset)"
+	}
+
+	return DisplayValue(*value)
+}
+
+// Prints the var journal, optionally only for one var
+func ShowVarHistory(name string) error {
+	entries, err := ReadVarJournal(name)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s  %s  %s: %s => %s\n",
+			entry.Time.Format(time.RFC3339),
+			entry.User,
+			entry.Name,
+			journalValue(entry.Old),
+			journalValue(entry.New),
+		)
+	}
+
+	return nil
+}
+
+// Restores a var to an earlier value
+// Without a timestamp, this undoes the last change to the var.
+// With a timestamp, this restores the value the var had at that time.
+func RevertVar(name string, to string) error {
+	if err := checkVarName(name); err != nil {
+		return err
+	}
+	entries, err := ReadVarJournal(name)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return GenericError(nil, "there are no journaled changes for %s", name)
+	}
+
+	var value *string
+	if to == "" {
+		value = entries[len(entries)-1].Old
+	} else {
+		at, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return GenericError(err, "invalid timestamp, use the format shown by 'morio vars history'")
+		}
+		// The value before the first change, unless a change happened before the timestamp
+		// History shows timestamps by the second, so we compare by the second too.
+		value = entries[0].Old
+		for _, entry := range entries {
+			if entry.Time.Truncate(time.Second).After(at) {
+				break
+			}
+			value = entry.New
+		}
+	}
+
+	fmt.Printf("Reverting %s to %s\n", name, journalValue(value))
+	if value == nil {
+		return RmVar(name)
+	}
+
+	return SetVar(name, *value)
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevertVar(t *testing.T) {
+	useTestRoot(t)
+	for _, value := range []string{"1", "2"} {
+		if err := SetVar("MORIO_TEST", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := ReadVarJournal("MORIO_TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Old != nil || *entries[1].New != "2" {
+		t.Fatalf("got %d journal entries, want the two changes", len(entries))
+	}
+
+	// Reverting undoes the last change, which is itself journaled
+	want := []string{"1", "2", "1"}
+	for _, value := range want {
+		if err := RevertVar("MORIO_TEST", ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := getCustomVar("MORIO_TEST"); got == nil || *got != value {
+			t.Errorf("after revert: got %v, want %s", got, value)
+		}
+	}
+
+	// Reverting to before the first change removes the var
+	if err := RevertVar("MORIO_TEST", entries[0].Time.Add(-time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	if got := getCustomVar("MORIO_TEST"); got != nil {
+		t.Errorf("got %q, want the var removed", *got)
+	}
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Host facts are read-only vars that are gathered at template time
+// They all share this prefix, which cannot be used for other vars.
+const HostFactPrefix string = "MORIO_HOST_"
+
+// The names of the host facts, without their prefix
+var hostFactNames = []string{"HOSTNAME", "FQDN", "OS", "OS_FAMILY", "OS_NAME", "OS_VERSION", "ARCH", "IP", "MACHINE_ID", "CPUS", "MEMORY"}
+
+var (
+	hostFacts     map[string]string
+	hostFactsOnce sync.Once
+)
+
+// Checks whether a var name is in the host facts namespace
+func IsHostFact(name string) bool {
+	return strings.HasPrefix(name, HostFactPrefix)
+}
+
+// Returns the host facts
+// These are only gathered once per run, and only when rendering, since
+// looking up the FQDN can be slow.
+func GetHostFacts() map[string]string {
+	hostFactsOnce.Do(func() {
+		hostFacts = gatherHostFacts()
+	})
+	facts := make(map[string]string, len(hostFacts))
+	for key, val := range hostFacts {
+		facts[key] = val
+	}
+
+	return facts
+}
+
+// Adds the host facts to a var context
+// Host facts are read-only, so they override anything else.
+func AddHostFacts(context map[string]string) {
+	for key, val := range GetHostFacts() {
+		context[key] = val
+	}
+}
+
+func gatherHostFacts() map[string]string {
+	hostname, _ := os.Hostname()
+	osRelease := readOSRelease()
+	family := runtime.GOOS
+	if runtime.GOOS == "linux" {
+		family = osFamily(osRelease)
+	}
+
+	return map[string]string{
+		HostFactPrefix + "HOSTNAME":   hostname,
+		HostFactPrefix + "FQDN":       lookupFQDN(hostname),
+		HostFactPrefix + "OS":         runtime.GOOS,
+		HostFactPrefix + "OS_FAMILY":  family,
+		HostFactPrefix + "OS_NAME":    osRelease["ID"],
+		HostFactPrefix + "OS_VERSION": osRelease["VERSION_ID"],
+		HostFactPrefix + "ARCH":       runtime.GOARCH,
+		HostFactPrefix + "IP":         primaryIP(),
+		HostFactPrefix + "MACHINE_ID": machineID(),
+		HostFactPrefix + "CPUS":       strconv.Itoa(runtime.NumCPU()),
+		HostFactPrefix + "MEMORY":     totalMemory(),
+	}
+}
+
+// Reads /etc/os-release into a map
+func readOSRelease() map[string]string {
+	release := make(map[string]string)
+	file, err := os.Open("/etc/os-release")
+	if err != nil {
+		return release
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found {
+			release[key] = strings.Trim(value, `"'`)
+		}
+	}
+
+	return release
+}
+
+// Groups Linux distributions into families, so templates do not have to
+// know about every derivative
+func osFamily(release map[string]string) string {
+	ids := strings.Fields(release["ID"] + " " + release["ID_LIKE"])
+	for _, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			return "debian"
+		case "rhel", "fedora", "centos":
+			return "rhel"
+		case "suse", "opensuse", "sles":
+			return "suse"
+		}
+	}
+	if len(ids) > 0 {
+		return ids[0]
+	}
+
+	return "linux"
+}
+
+// Resolves the fully qualified domain name of the host, like hostname -f
+// Falls back to the hostname if it cannot be resolved.
+func lookupFQDN(hostname string) string {
+	isFQDN := func(name string) bool {
+		return strings.Contains(name, ".") && !strings.HasPrefix(name, "localhost")
+	}
+	if cname, err := net.LookupCNAME(hostname); err == nil {
+		if cname = strings.TrimSuffix(cname, "."); isFQDN(cname) {
+			return cname
+		}
+	}
+	addrs, err := net.LookupHost(hostname)
+	if err != nil {
+		return hostname
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip == nil || ip.IsLoopback() {
+			continue
+		}
+		names, err := net.LookupAddr(addr)
+		if err == nil && len(names) > 0 {
+			if name := strings.TrimSuffix(names[0], "."); isFQDN(name) {
+				return name
+			}
+		}
+	}
+
+	return hostname
+}
+
+// Returns the IP address of the interface that holds the default route
+// Dialing UDP does not send any packets, it merely selects a route.
+func primaryIP() string {
+	conn, err := net.Dial("udp", "192.0.2.1:9")
+	if err == nil {
+		defer conn.Close()
+		if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+			return addr.IP.String()
+		}
+	}
+
+	// No default route, so use the first address that is not a loopback
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			return ipnet.IP.String()
+		}
+	}
+
+	return ""
+}
+
+func machineID() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id, err := os.ReadFile(path); err == nil {
+			return strings.TrimSpace(string(id))
+		}
+	}
+
+	return ""
+}
+
+// Returns the total memory in bytes
+func totalMemory() string {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return ""
+			}
+			return strconv.FormatUint(kb*1024, 10)
+		}
+	}
+
+	return ""
+}
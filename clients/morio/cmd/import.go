@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Imports vars from a file
+// With dryRun, this only shows what would change.
+// With replace, custom vars that are not in the file are removed.
+func ImportVars(path string, format string, dryRun bool, replace bool) error {
+	vars, err := ReadVarsFile(path, format)
+	if err != nil {
+		return err
+	}
+
+	// Keep track of what is in the file before we skip redacted secrets
+	inFile := make(map[string]bool)
+	for key, value := range vars {
+		inFile[key] = true
+		if value == RedactedValue {
+			delete(vars, key)
+		}
+	}
+
+	// Imported vars are custom vars, so we compare to those only. A value that
+	// matches a default or an env var is still pinned as a custom var.
+	customs, err := ListVarNames(CustomVarFolder())
+	if err != nil {
+		return err
+	}
+	current := make(map[string]string, len(customs))
+	for _, key := range customs {
+		if value := getCustomVar(key); value != nil {
+			current[key] = *value
+		}
+	}
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		return err
+	}
+	if err := ValidateVars(vars, declarations); err != nil {
+		return err
+	}
+
+	// Figure out what changes
+	changed := make(map[string]string)
+	for key, value := range vars {
+		old, exists := current[key]
+		if exists {
+			if revealed, err := RevealSecret(old); err == nil && sameVarValue(revealed, value) {
+				continue
+			}
+		}
+		changed[key] = value
+	}
+	var removed []string
+	if replace {
+		for _, key := range customs {
+			if !inFile[key] {
+				removed = append(removed, key)
+			}
+		}
+	}
+
+	// Show the changes
+	if len(changed) == 0 && len(removed) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+	display := func(key string, value string) string {
+		if IsSecretVar(key, declarations) {
+			return RedactedValue
+		}
+		return DisplayValue(value)
+	}
+	for _, key := range SortedVarNames(changed) {
+		if old, exists := current[key]; exists {
+			fmt.Printf("~ %s: %s => %s\n", key, display(key, old), display(key, changed[key]))
+		} else {
+			fmt.Printf("+ %s: %s\n", key, display(key, changed[key]))
+		}
+	}
+	for _, key := range removed {
+		fmt.Printf("- %s: %s\n", key, display(key, current[key]))
+	}
+	if dryRun {
+		return nil
+	}
+
+	// Apply the changes, but not if that would touch a locked var
+	if err := CheckVarLocks(append(SortedVarNames(changed), removed...)); err != nil {
+		return err
+	}
+	if err := ValidateAndSetVars(changed, false); err != nil {
+		return err
+	}
+	for _, key := range removed {
+		if err := RmVar(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks whether two values are the same, even if they are formatted differently
+// For example, [ "a","b" ] and ["a", "b"] are the same list.
+func sameVarValue(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	parsedA, errA := parseYAMLValue(a)
+	parsedB, errB := parseYAMLValue(b)
+
+	return errA == nil && errB == nil && reflect.DeepEqual(parsedA, parsedB)
+}
+
+// Reads vars from a JSON, YAML, or dotenv file
+// If no format is given, it is derived from the file extension.
+func ReadVarsFile(path string, format string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ConfigError(err, "failed to open file")
+	}
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			format = "json"
+		case ".yml", ".yaml":
+			format = "yaml"
+		case ".env":
+			format = "dotenv"
+		default:
+			return nil, ConfigError(nil, "unable to determine the format of %s, use --format to specify it", path)
+		}
+	}
+
+	vars := make(map[string]string)
+	var typed map[string]interface{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &typed); err != nil {
+			return nil, ConfigError(err, "failed to parse JSON")
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &typed); err != nil {
+			return nil, ConfigError(err, "failed to parse YAML")
+		}
+	case "dotenv":
+		return parseDotenv(data)
+	default:
+		return nil, ConfigError(nil, "unsupported format '%s', use json, yaml, or dotenv", format)
+	}
+	for key, value := range typed {
+		vars[key] = FormatVarValue(value)
+	}
+
+	return vars, nil
+}
+
+// Converts a typed value to how it is stored in a var file
+// Lists and maps are stored as JSON, which is also valid YAML.
+func FormatVarValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(encoded)
+}
+
+// Parses a dotenv file
+// This supports comments, an optional export prefix, and quoted values.
+// Unlike a shell, it does not expand variables.
+func parseDotenv(data []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, ConfigError(nil, "failed to parse dotenv on line %d", lineNumber)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, ConfigError(err, "failed to parse dotenv on line %d", lineNumber)
+			}
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		} else if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ConfigError(err, "failed to read dotenv file")
+	}
+
+	return vars, nil
+}
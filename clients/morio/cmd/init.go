@@ -16,19 +16,22 @@ housekeeping chores.
 
 This command is idempotent. In other words, you can run it more
 than once without side-effects.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	Annotations: mutating,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		client := GetVar("MORIO_CLIENT_UUID")
 		if client == "" {
 			fmt.Println("Initializing Morio client.")
 			client = uuid.New().String()
-			SetDefaultVar("MORIO_CLIENT_UUID", client)
+			if err := SetDefaultVar("MORIO_CLIENT_UUID", client); err != nil {
+				return err
+			}
 			fmt.Println("Morio client initialised with UUID " + client)
 		} else {
 			fmt.Println("This Morio client is already initialised.")
 			fmt.Println("Its UUID is " + client)
 		}
 		fmt.Println("\nAgent status:")
-		ShowStatus()
+		return ShowStatus()
 	},
 }
 
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/spf13/viper"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Environment variables with this prefix override all other vars
+const EnvVarPrefix string = "MORIO_VAR_"
+
+// The default location of the runtime (volatile) files of the Morio client
+const DefaultRuntimeRoot string = "/run/morio"
+
+// A layer of vars
+// Layers are consulted in order of precedence, the first one to have a var wins.
+type varLayer struct {
+	Source string
+	// Lists the names of the vars in this layer
+	Names func() ([]string, error)
+	// Returns the value of a var, and whether it was found in this layer
+	Get func(key string) (string, bool)
+}
+
+// Location of the runtime (volatile) vars
+// This is $MORIO_RUNTIME/vars.d, or runtime/vars.d under the installation
+// root when it is not /etc/morio, so --root never reads the host's runtime vars.
+func RuntimeVarFolder() string {
+	root := viper.GetString("runtime")
+	if root == "" && GetConfigRoot() != filepath.Clean(DefaultConfigRoot) {
+		root = GetConfigPath("runtime")
+	}
+	if root == "" {
+		root = DefaultRuntimeRoot
+	}
+
+	return filepath.Join(root, "vars.d")
+}
+
+// Returns the var layers, in order of precedence
+// Host facts are not a layer, as they are read-only and only exist at template time.
+func varLayers() []varLayer {
+	layers := []varLayer{
+		optionalFolderLayer(VarSourceLocked, LockedVarFolder()),
+		{Source: VarSourceEnv, Names: envVarNames, Get: envVar},
+		optionalFolderLayer(VarSourceRuntime, RuntimeVarFolder()),
+	}
+	if viper.GetString("vars-file") != "" {
+		layers = append(layers, varLayer{Source: VarSourceFile, Names: varsFileNames, Get: varsFileVar})
+	}
+	layers = append(layers, folderLayer(VarSourceCustom, CustomVarFolder()))
+	if profile := ActiveProfile(); profile != "" {
+		layers = append(layers, folderLayer(VarSourceProfile, ProfileFolder(profile)))
+	}
+
+	return append(layers, folderLayer(VarSourceDefault, DefaultVarFolder()))
+}
+
+// A layer that holds one var per file in a folder
+func folderLayer(source string, folder string) varLayer {
+	return varLayer{
+		Source: source,
+		Names: func() ([]string, error) {
+			return ListVarNames(folder)
+		},
+		Get: func(key string) (string, bool) {
+			// Read entire file in one gulp
+			value, err := os.ReadFile(filepath.Join(folder, key))
+			if err != nil {
+				return "", false
+			}
+			return string(value), true
+		},
+	}
+}
+
+// Like folderLayer, but the folder does not have to exist
+func optionalFolderLayer(source string, folder string) varLayer {
+	layer := folderLayer(source, folder)
+	names := layer.Names
+	layer.Names = func() ([]string, error) {
+		if _, err := os.Stat(folder); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return names()
+	}
+
+	return layer
+}
+
+func envVarNames() ([]string, error) {
+	var names []string
+	for _, env := range os.Environ() {
+		key, _, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(key, EnvVarPrefix) && len(key) > len(EnvVarPrefix) {
+			names = append(names, strings.TrimPrefix(key, EnvVarPrefix))
+		}
+	}
+
+	return names, nil
+}
+
+func envVar(key string) (string, bool) {
+	return os.LookupEnv(EnvVarPrefix + key)
+}
+
+var (
+	varsFile     map[string]string
+	varsFileErr  error
+	varsFileOnce sync.Once
+)
+
+// Reads the vars file passed with --vars-file (only once per run)
+func loadVarsFile() (map[string]string, error) {
+	varsFileOnce.Do(func() {
+		varsFile, varsFileErr = ReadVarsFile(viper.GetString("vars-file"), "")
+	})
+
+	return varsFile, varsFileErr
+}
+
+func varsFileNames() ([]string, error) {
+	vars, err := loadVarsFile()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(vars))
+	for key := range vars {
+		names = append(names, key)
+	}
+
+	return names, nil
+}
+
+func varsFileVar(key string) (string, bool) {
+	vars, err := loadVarsFile()
+	if err != nil {
+		return "", false
+	}
+	value, found := vars[key]
+
+	return value, found
+}
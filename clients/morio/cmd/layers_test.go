@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestVarLayerPrecedence(t *testing.T) {
+	useTestRoot(t)
+	// Each step adds a layer that takes precedence over the ones before it
+	steps := []struct {
+		source string
+		add    func()
+	}{
+		{VarSourceDefault, func() { writeTestFile(t, "default.vars.d/MORIO_TEST", VarSourceDefault) }},
+		{VarSourceProfile, func() {
+			writeTestFile(t, "profiles.d/test/MORIO_TEST", VarSourceProfile)
+			writeTestFile(t, "active-profile", "test\n")
+		}},
+		{VarSourceCustom, func() { writeTestFile(t, "vars.d/MORIO_TEST", VarSourceCustom) }},
+		{VarSourceRuntime, func() { writeTestFile(t, "runtime/vars.d/MORIO_TEST", VarSourceRuntime) }},
+		{VarSourceEnv, func() { t.Setenv(EnvVarPrefix+"MORIO_TEST", VarSourceEnv) }},
+		{VarSourceLocked, func() { writeTestFile(t, "locked.vars.d/MORIO_TEST", VarSourceLocked) }},
+	}
+
+	for _, step := range steps {
+		step.add()
+		value, source := LookupVar("MORIO_TEST")
+		if value != step.source || source != step.source {
+			t.Errorf("after adding the %s layer: got %q from %s", step.source, value, source)
+		}
+		vars, sources, err := GetVarsWithSources()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vars["MORIO_TEST"] != step.source || sources["MORIO_TEST"] != step.source {
+			t.Errorf("after adding the %s layer: listed %q from %s", step.source, vars["MORIO_TEST"], sources["MORIO_TEST"])
+		}
+	}
+}
+
+func TestRuntimeVarFolderUnderRoot(t *testing.T) {
+	root := useTestRoot(t)
+	if got, want := RuntimeVarFolder(), filepath.Join(root, "runtime", "vars.d"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,498 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// morio template lint
+var templateLintCmd = &cobra.Command{
+	Use:   "lint [file or folder]...",
+	Short: "Check module templates for common mistakes",
+	Example: `  morio template lint
+  morio template lint --format json ./logs/module-templates.d`,
+	Long: `Checks module templates for common mistakes.
+
+Each template is checked for:
+  - valid YAML after rendering
+  - a moriodata block with info, version, href, and a dflt for every var
+  - vars that are used but not declared, or declared but not used
+  - input ids that are used more than once
+  - file extensions that will cause the template to be ignored
+
+Without arguments, the templates in the installation root are checked.
+The exit code is 3 when errors are found. Warnings do not affect it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			return GenericError(nil, "unsupported format %s, use text or json", format)
+		}
+		report, err := LintTemplates(args)
+		if err != nil {
+			return err
+		}
+		if err := report.Print(format); err != nil {
+			return err
+		}
+		if report.Errors > 0 {
+			return TemplateError(nil, "%d template error(s) found", report.Errors)
+		}
+		return nil
+	},
+}
+
+func init() {
+	templateCmd.AddCommand(templateLintCmd)
+	templateLintCmd.Flags().String("format", "text", "output format, one of text or json")
+}
+
+// Severity of a lint finding
+const (
+	LintError   string = "error"
+	LintWarning string = "warning"
+)
+
+// Vars that are added to the context when a template is rendered
+var renderTimeVars = []string{"MORIO_TEMPLATE_SOURCE_FILE", "MORIO_MODULE_NAME"}
+
+// A problem found in a template
+// Problems found in the rendered template have a RenderedLine rather than a Line,
+// since the lines of the template and its rendered output do not match.
+type lintFinding struct {
+	File         string `json:"file"`
+	Line         int    `json:"line,omitempty"`
+	RenderedLine int    `json:"rendered_line,omitempty"`
+	Severity     string `json:"severity"`
+	Check        string `json:"check"`
+	Message      string `json:"message"`
+}
+
+// The result of linting templates
+type lintReport struct {
+	Files    int           `json:"files"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+	Findings []lintFinding `json:"findings"`
+}
+
+func (report *lintReport) add(file string, line int, severity string, check string, format string, args ...interface{}) {
+	report.record(lintFinding{File: file, Line: line, Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// Adds a problem found on a line of the rendered template
+func (report *lintReport) addRendered(file string, line int, severity string, check string, format string, args ...interface{}) {
+	report.record(lintFinding{File: file, RenderedLine: line, Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+func (report *lintReport) record(finding lintFinding) {
+	report.Findings = append(report.Findings, finding)
+	if finding.Severity == LintError {
+		report.Errors++
+	} else {
+		report.Warnings++
+	}
+}
+
+// Prints the report as text or JSON
+func (report *lintReport) Print(format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return GenericError(err, "unable to serialize lint report")
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, finding := range report.Findings {
+		location := finding.File
+		if finding.Line > 0 {
+			location = fmt.Sprintf("%s:%d", finding.File, finding.Line)
+		} else if finding.RenderedLine > 0 {
+			location = fmt.Sprintf("%s (rendered line %d)", finding.File, finding.RenderedLine)
+		}
+		fmt.Printf("%s: %s: %s (%s)\n", location, finding.Severity, finding.Message, finding.Check)
+	}
+	fmt.Printf("%d template(s) checked, %d error(s), %d warning(s)\n", report.Files, report.Errors, report.Warnings)
+
+	return nil
+}
+
+// Lints the templates in the given files or folders
+// Without paths, the module templates of the installation are linted.
+func LintTemplates(paths []string) (*lintReport, error) {
+	if len(paths) == 0 {
+		for _, folder := range moduleTemplateFolders {
+			paths = append(paths, GetConfigPath(folder))
+		}
+	}
+
+	// Vars declared in the global vars are fine to use in any template
+	// Outside an installation there are none, so errors are ignored.
+	globals := make(map[string]interface{})
+	if vars, err := ReadGlobalVars(); err == nil {
+		globals = vars
+	}
+
+	report := &lintReport{Findings: []lintFinding{}}
+	ids := make(map[string]map[string]string)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, ConfigError(err, "unable to read %s", path)
+		}
+		if !info.IsDir() {
+			lintTemplateFile(path, globals, ids, report)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, ConfigError(err, "unable to read files from folder at %s", path)
+		}
+		for _, entry := range entries {
+			file := filepath.Join(path, entry.Name())
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) == ".md" {
+				continue
+			}
+			if !isTemplateFileName(entry.Name()) {
+				report.add(file, 0, LintWarning, "extension", "templates must end in .yml (or .yml.disabled), so this file is ignored")
+				continue
+			}
+			lintTemplateFile(file, globals, ids, report)
+		}
+	}
+
+	return report, nil
+}
+
+// Checks whether a file name is that of an enabled or disabled template
+func isTemplateFileName(name string) bool {
+	return filepath.Ext(name) == ".yml" || strings.HasSuffix(name, ".yml.disabled")
+}
+
+// Lints a single template
+// Input ids are tracked per agent in ids, since they must be unique per agent.
+func lintTemplateFile(file string, globals map[string]interface{}, ids map[string]map[string]string, report *lintReport) {
+	report.Files++
+	data, err := os.ReadFile(file)
+	if err != nil {
+		report.add(file, 0, LintError, "read", "unable to read template: %v", err)
+		return
+	}
+	template := string(data)
+
+	// Find the moriodata first, so we can render with the declared defaults
+	context := lintContext(file, globals, nil)
+	var moriodata map[string]interface{}
+	if items, err := renderLintYAML(file, moriodataSource(template), context); err == nil {
+		moriodata = lintMoriodata(file, items, report)
+	}
+	declared, _ := moriodata["vars"].(map[string]interface{})
+
+	// Now render with the defaults, and make sure the result is valid YAML
+	context = lintContext(file, globals, declared)
+	var doc yaml.Node
+	rendered, err := RenderTemplate(template, file, context, false)
+	if err != nil {
+		report.add(file, 0, LintError, "render", "unable to render template: %v", err)
+		return
+	}
+	if err := yaml.Unmarshal([]byte(rendered), &doc); err != nil {
+		report.add(file, 0, LintError, "yaml", "rendered template is not valid YAML: %v", err)
+		return
+	}
+	if moriodata == nil {
+		report.add(file, 0, LintError, "moriodata", "template has no moriodata block")
+	}
+
+	partials, err := TemplatePartials(template)
+	if err != nil {
+		report.add(file, 0, LintError, "partials", "%v", err)
+		return
+	}
+	lintPartials(file, moriodata, partials, report)
+	lintTemplateVars(file, template, partials, declared, globals, report)
+	lintInputIds(file, &doc, ids, report)
+}
+
+// Checks that moriodata.partials lists the partials that a template uses
+func lintPartials(file string, moriodata map[string]interface{}, partials []string, report *lintReport) {
+	recorded := make(map[string]bool)
+	switch list := moriodata["partials"].(type) {
+	case nil:
+	case []interface{}:
+		for _, name := range list {
+			recorded[fmt.Sprint(name)] = true
+		}
+	default:
+		report.add(file, 0, LintError, "partials", "moriodata.partials is not a list")
+		return
+	}
+	used := make(map[string]bool)
+	for _, name := range partials {
+		used[name] = true
+		if !recorded[name] {
+			report.add(file, 0, LintError, "partials", "partial %s is used but not listed in moriodata.partials", name)
+		}
+	}
+	for _, name := range sortedKeys(recorded) {
+		if !used[name] {
+			report.add(file, 0, LintWarning, "partials", "partial %s is listed in moriodata.partials but not used", name)
+		}
+	}
+}
+
+// Builds a render context from the global and template defaults
+func lintContext(file string, globals map[string]interface{}, declared map[string]interface{}) map[string]interface{} {
+	declarations := make(map[string][]VarDeclaration)
+	for _, vars := range []map[string]interface{}{globals, declared} {
+		for name, spec := range vars {
+			if decl, err := ParseVarDeclaration(name, spec, file); err == nil {
+				declarations[name] = []VarDeclaration{decl}
+			}
+		}
+	}
+	context := ExtractDefaultsFromVars(globals)
+	if declared != nil {
+		for key, val := range ExtractDefaultsFromVars(declared) {
+			context[key] = val
+		}
+	}
+	// Vars that the client manages and host facts are not known up front, so we use a placeholder
+	for _, name := range clientManagedVars {
+		context[name] = "placeholder-" + strings.ToLower(name)
+	}
+	for _, name := range hostFactNames {
+		context[HostFactPrefix+name] = "placeholder-" + strings.ToLower(HostFactPrefix+name)
+	}
+	context["MORIO_TEMPLATE_SOURCE_FILE"] = file
+	context["MORIO_MODULE_NAME"] = ModuleNameFromFile(file)
+
+	return TypedContext(context, declarations)
+}
+
+// Renders a template and parses it as a list of YAML items
+func renderLintYAML(file string, template string, context map[string]interface{}) ([]map[string]interface{}, error) {
+	rendered, err := RenderTemplate(template, file, context, false)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]interface{}
+	if err := yaml.Unmarshal([]byte(rendered), &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Checks the moriodata block, and returns it
+func lintMoriodata(file string, items []map[string]interface{}, report *lintReport) map[string]interface{} {
+	var found interface{}
+	for _, item := range items {
+		if moriodata, ok := item["moriodata"]; ok {
+			found = moriodata
+			break
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	moriodata, ok := found.(map[string]interface{})
+	if !ok {
+		report.add(file, 0, LintError, "moriodata", "moriodata is not a map")
+		return map[string]interface{}{}
+	}
+
+	for _, key := range []string{"info", "version", "href"} {
+		val, ok := moriodata[key]
+		if !ok || fmt.Sprintf("%v", val) == "" {
+			report.add(file, 0, LintError, "moriodata", "moriodata has no %s", key)
+		}
+	}
+	if href, ok := moriodata["href"].(string); ok && href != "" && !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+		report.add(file, 0, LintWarning, "moriodata", "moriodata.href is not a URL")
+	}
+
+	if _, err := ParseConditions(moriodata["when"]); err != nil {
+		report.add(file, 0, LintError, "moriodata", "%v", err)
+	}
+
+	vars, hasVars := moriodata["vars"]
+	if !hasVars {
+		return moriodata
+	}
+	varsMap, ok := vars.(map[string]interface{})
+	if !ok {
+		report.add(file, 0, LintError, "moriodata", "moriodata.vars is not a map")
+		delete(moriodata, "vars")
+		return moriodata
+	}
+	for _, name := range sortedKeys(varsMap) {
+		if _, ok := varsMap[name].(map[string]interface{}); !ok {
+			report.add(file, 0, LintError, "moriodata", "var %s is not a map", name)
+			continue
+		}
+		decl, err := ParseVarDeclaration(name, varsMap[name], file)
+		if err != nil {
+			report.add(file, 0, LintError, "moriodata", "%v", err)
+			continue
+		}
+		if !decl.HasDflt {
+			report.add(file, 0, LintError, "moriodata", "var %s has no dflt", name)
+			continue
+		}
+		if dflt, found := ExtractDefaultsFromVars(map[string]interface{}{name: varsMap[name]})[name]; found {
+			if err := decl.Validate(dflt); err != nil {
+				report.add(file, 0, LintError, "moriodata", "dflt of var %s does not match its declaration: %v", name, err)
+			}
+		}
+	}
+
+	return moriodata
+}
+
+// Matches any mustache tag, capturing its type and name
+var templateTag = regexp.MustCompile(`\{\|\s*([#^/&{!=>]?)\s*([^|{}\s]+)\s*\}?\s*\|\}`)
+
+// Reports vars that are used but not declared, or declared but not used
+// Vars used in the partials of a template count as used by the template.
+// Names used inside a section can be keys of the items that it loops over, so
+// they count as used, but are not reported when they are not declared.
+func lintTemplateVars(file string, template string, partials []string, declared map[string]interface{}, globals map[string]interface{}, report *lintReport) {
+	used := make(map[string]bool)
+	checked := make(map[string]bool)
+	engine, err := TemplateEngine(template)
+	if err != nil {
+		report.add(file, 0, LintError, "moriodata", "%v", err)
+		return
+	}
+	sources := map[string]string{file: template}
+	files := []string{file}
+	for _, name := range partials {
+		if partial, err := ReadPartial(name); err == nil {
+			sources[PartialPath(name)] = partial
+			files = append(files, PartialPath(name))
+		}
+	}
+	for _, source := range files {
+		depth := 0
+		for i, line := range strings.Split(sources[source], "\n") {
+			names, nested := lineVarNames(line, engine, &depth)
+			for _, name := range nested {
+				used[name] = true
+			}
+			for _, name := range names {
+				if checked[name] {
+					continue
+				}
+				used[name] = true
+				checked[name] = true
+				_, isDeclared := declared[name]
+				_, isGlobal := globals[name]
+				if !isDeclared && !isGlobal && !IsHostFact(name) && !isClientManagedVar(name) && !isRenderTimeVar(name) {
+					report.add(source, i+1, LintError, "undeclared-var", "var %s is used but not declared", name)
+				}
+			}
+		}
+	}
+	for _, name := range sortedKeys(declared) {
+		if !used[name] {
+			report.add(file, 0, LintWarning, "unused-var", "var %s is declared but not used", name)
+		}
+	}
+}
+
+var goTemplateAction = regexp.MustCompile(`\{\{(.*?)\}\}`)
+var goTemplateField = regexp.MustCompile(`(?:^|[\s(|$])\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Returns the names of the vars that a line of a template uses
+// Names used inside a mustache section are returned as nested. The depth of
+// the sections is kept in depth, since a section can span lines.
+func lineVarNames(line string, engine string, depth *int) (names []string, nested []string) {
+	if engine == EngineGo {
+		for _, action := range goTemplateAction.FindAllStringSubmatch(line, -1) {
+			for _, match := range goTemplateField.FindAllStringSubmatch(action[1], -1) {
+				names = append(names, match[1])
+			}
+		}
+		return names, nil
+	}
+	for _, match := range templateTag.FindAllStringSubmatch(line, -1) {
+		if strings.ContainsAny(match[1], "!=>") || match[2] == "." {
+			continue
+		}
+		if match[1] == "/" {
+			*depth--
+			continue
+		}
+		name := strings.SplitN(match[2], ".", 2)[0]
+		if *depth > 0 {
+			nested = append(nested, name)
+		} else {
+			names = append(names, name)
+		}
+		if match[1] == "#" || match[1] == "^" {
+			*depth++
+		}
+	}
+
+	return names, nested
+}
+
+func isRenderTimeVar(name string) bool {
+	for _, v := range renderTimeVars {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reports input ids that are used more than once by the same agent
+// An agent can have more than one template folder, like logs/input-templates.d
+// and logs/module-templates.d, so ids are tracked per agent folder.
+func lintInputIds(file string, doc *yaml.Node, ids map[string]map[string]string, report *lintReport) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.SequenceNode {
+		return
+	}
+	agent := filepath.Dir(filepath.Dir(file))
+	if ids[agent] == nil {
+		ids[agent] = make(map[string]string)
+	}
+	for _, item := range doc.Content[0].Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			key, val := item.Content[i], item.Content[i+1]
+			if key.Value != "id" || val.Kind != yaml.ScalarNode {
+				continue
+			}
+			// The ids are read from the rendered template, so their lines are those of the output
+			location := fmt.Sprintf("%s (rendered line %d)", file, val.Line)
+			if first, seen := ids[agent][val.Value]; seen {
+				report.addRendered(file, val.Line, LintError, "duplicate-id", "input id %s is also used at %s", val.Value, first)
+			} else {
+				ids[agent][val.Value] = location
+			}
+		}
+	}
+}
+
+// Returns the keys of a map in alphabetical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestLintTemplates(t *testing.T) {
+	useTestRoot(t)
+	writeTestFile(t, "logs/module-templates.d/a.yml", `- moriodata:
+    info: A
+    vars:
+      MORIO_ITEMS:
+        info: The items
+        dflt: [ { name: a } ]
+        type: list
+- type: filestream
+  id: shared
+  paths:
+{|#MORIO_ITEMS|}
+    - {|name|}
+{|/MORIO_ITEMS|}
+  tags: [ "{|MORIO_UNDECLARED|}" ]
+`)
+	writeTestFile(t, "logs/input-templates.d/b.yml", `- moriodata:
+    info: B
+- type: filestream
+  id: shared
+`)
+
+	report, err := LintTemplates([]string{GetConfigPath("logs/module-templates.d"), GetConfigPath("logs/input-templates.d")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for _, finding := range report.Findings {
+		got[finding.Check] = append(got[finding.Check], finding.Message)
+	}
+	// The name key of the items is not a var
+	if want := "var MORIO_UNDECLARED is used but not declared"; len(got["undeclared-var"]) != 1 || got["undeclared-var"][0] != want {
+		t.Errorf("got %v, want only %q", got["undeclared-var"], want)
+	}
+	if len(got["unused-var"]) != 0 {
+		t.Errorf("got %v, want MORIO_ITEMS used", got["unused-var"])
+	}
+	// Both folders hold templates for the logs agent
+	if len(got["duplicate-id"]) != 1 {
+		t.Errorf("got %v, want the shared id reported once", got["duplicate-id"])
+	}
+}
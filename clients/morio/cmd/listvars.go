@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Returns the declared type of a var, or an empty string if it is not declared
+func declaredVarType(name string, declarations map[string][]VarDeclaration) string {
+	if decls := declarations[name]; len(decls) > 0 {
+		return decls[0].Type
+	}
+
+	return ""
+}
+
+// Normalizes a list or map value, so it is stored the same way regardless of
+// whether it was given as YAML or JSON
+// Lists and maps are stored as JSON. Other values are returned as-is.
+func NormalizeVarValue(value string, varType string) string {
+	trimmed := strings.TrimSpace(value)
+	switch varType {
+	case "list", "map":
+	case "":
+		// Not declared, so only flow lists and maps are normalized
+		if !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "{") {
+			return value
+		}
+	default:
+		return value
+	}
+	if trimmed == "" || IsSecretValue(value) {
+		return value
+	}
+	parsed, err := parseYAMLValue(value)
+	if err != nil {
+		return value
+	}
+	switch parsed.(type) {
+	case []interface{}, map[string]interface{}:
+		return FormatVarValue(parsed)
+	}
+
+	return value
+}
+
+// Normalizes the list and map values in vars
+func normalizeVarValues(vars map[string]string, declarations map[string][]VarDeclaration) map[string]string {
+	normalized := make(map[string]string, len(vars))
+	for key, value := range vars {
+		normalized[key] = NormalizeVarValue(value, declaredVarType(key, declarations))
+	}
+
+	return normalized
+}
+
+// Adds an item to a list var, or removes it
+// This starts from the current value of the var, wherever it comes from,
+// and writes the result as a custom var.
+func EditListVar(name string, item string, remove bool) error {
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		return err
+	}
+	varType := declaredVarType(name, declarations)
+	if varType != "" && varType != "list" {
+		return ValidationError(nil, "%s is declared as %s, only list vars can be appended to or removed from", name, varType)
+	}
+
+	current := GetVar(name)
+	list := []interface{}{}
+	if strings.TrimSpace(current) != "" {
+		parsed, err := parseYAMLValue(current)
+		var ok bool
+		if list, ok = parsed.([]interface{}); err != nil || !ok {
+			return ValidationError(err, "%s is not a list", name)
+		}
+	}
+	parsedItem, err := parseYAMLValue(item)
+	if err != nil || parsedItem == nil {
+		parsedItem = item
+	}
+
+	index := -1
+	for i, existing := range list {
+		if reflect.DeepEqual(existing, parsedItem) {
+			index = i
+			break
+		}
+	}
+	switch {
+	case remove && index < 0:
+		fmt.Fprintf(os.Stderr, "%s does not contain %s\n", name, item)
+		return nil
+	case remove:
+		list = append(list[:index], list[index+1:]...)
+	case index >= 0:
+		fmt.Fprintf(os.Stderr, "%s already contains %s\n", name, item)
+		return nil
+	default:
+		list = append(list, parsedItem)
+	}
+
+	return ValidateAndSetVars(map[string]string{name: FormatVarValue(list)}, false)
+}
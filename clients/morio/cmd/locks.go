@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Set by the --force-unlock flag of 'morio vars'
+var forceUnlock bool
+
+// Location of the locked variables files
+// Locked vars are set by policy and take precedence over all other vars.
+func LockedVarFolder() string {
+	return GetConfigPath("locked.vars.d")
+}
+
+// Checks whether a var is locked
+// A var with an invalid name cannot be locked.
+func IsLockedVar(key string) bool {
+	if checkVarName(key) != nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(LockedVarFolder(), key))
+
+	return err == nil
+}
+
+// Makes sure none of the vars are locked
+// With --force-unlock, locked vars can be changed. Their locks are only lifted
+// by liftVarLock once the change is written, so a failed change keeps them.
+func CheckVarLocks(keys []string) error {
+	var locked []string
+	for _, key := range keys {
+		if err := checkVarName(key); err != nil {
+			return err
+		}
+		if IsLockedVar(key) {
+			locked = append(locked, key)
+		}
+	}
+	if len(locked) == 0 {
+		return nil
+	}
+	sort.Strings(locked)
+	if !forceUnlock {
+		return LockedError(nil, "refusing to change locked vars: %s (use --force-unlock to override)", strings.Join(locked, ", "))
+	}
+
+	return nil
+}
+
+// Lifts the lock on a var that was changed with --force-unlock
+func liftVarLock(key string) error {
+	if !forceUnlock {
+		return nil
+	}
+
+	return UnlockVar(key)
+}
+
+// Locks a var to a value
+func LockVar(key string, value string) error {
+	if err := checkVarName(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(LockedVarFolder(), 0755); err != nil {
+		return GenericError(err, "unable to create %s", LockedVarFolder())
+	}
+	if err := writeVarFile(filepath.Join(LockedVarFolder(), key), value); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Locked %s\n", key)
+
+	return nil
+}
+
+// Lifts the lock on a var
+func UnlockVar(key string) error {
+	if err := checkVarName(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(LockedVarFolder(), key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return GenericError(err, "unable to unlock var %s", key)
+	}
+	fmt.Fprintf(os.Stderr, "Unlocked %s\n", key)
+
+	return nil
+}
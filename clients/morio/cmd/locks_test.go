@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+// With --force-unlock, a lock is only lifted once the change is written
+func TestForceUnlockFailedChange(t *testing.T) {
+	useTestRoot(t)
+	if err := LockVar("MORIO_TEST", "locked"); err != nil {
+		t.Fatal(err)
+	}
+	// A folder in place of the var file makes writing and removing it fail
+	writeTestFile(t, "vars.d/MORIO_TEST/keep", "keep")
+
+	forceUnlock = true
+	defer func() { forceUnlock = false }()
+	checks := map[string]func() error{
+		"set": func() error { return SetVar("MORIO_TEST", "new") },
+		"rm":  func() error { return RmVar("MORIO_TEST") },
+	}
+	for check, run := range checks {
+		if err := run(); err == nil {
+			t.Errorf("%s: got no error, want the change to fail", check)
+		}
+		if !IsLockedVar("MORIO_TEST") {
+			t.Fatalf("%s: the lock was lifted by a change that failed", check)
+		}
+	}
+
+	if err := os.RemoveAll(GetConfigPath("vars.d/MORIO_TEST")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetVar("MORIO_TEST", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if IsLockedVar("MORIO_TEST") {
+		t.Errorf("the lock should be lifted once the change is written")
+	}
+	if value, source := LookupVar("MORIO_TEST"); value != "new" || source != VarSourceCustom {
+		t.Errorf("got %q from %s, want the new custom value", value, source)
+	}
+}
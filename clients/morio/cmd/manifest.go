@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// What 'morio template' rendered for an agent
+// This is what 'morio verify' checks the configuration against.
+type renderManifest struct {
+	Agent      string         `json:"agent"`
+	RenderedAt string         `json:"rendered_at"`
+	Files      []manifestFile `json:"files"`
+}
+
+// A rendered file in the manifest
+// Paths are relative to the installation root.
+type manifestFile struct {
+	Path     string   `json:"path"`
+	Source   string   `json:"source"`
+	VarsHash string   `json:"vars_sha256"`
+	Hash     string   `json:"sha256"`
+	Partials []string `json:"partials,omitempty"`
+}
+
+// Where the manifests are kept
+func ManifestFolder() string {
+	return GetConfigPath(".manifest")
+}
+
+// Location of the manifest of an agent
+func ManifestFile(agent string) string {
+	return filepath.Join(ManifestFolder(), agent+".json")
+}
+
+// Location of the manifest of the previous generation of an agent
+func previousManifestFile(agent string) string {
+	return filepath.Join(PreviousConfigFolder(), ".manifest", agent+".json")
+}
+
+// Returns the SHA-256 of a string, hex encoded
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Hashes the vars that the templates were rendered with
+// Secrets are left out, so the hash tells nothing about them, and so are the
+// vars that are set for each template while rendering.
+func VarsHash(context map[string]interface{}) string {
+	vars := make(map[string]interface{}, len(context))
+	for key, value := range context {
+		if isRenderTimeVar(key) {
+			continue
+		}
+		if _, ok := value.(secretValue); ok {
+			value = RedactedValue
+		}
+		vars[key] = value
+	}
+	// Map keys are sorted when marshalled, so the hash is stable
+	data, _ := json.Marshal(vars)
+
+	return sha256Hex(string(data))
+}
+
+// Writes the manifest of every agent that was rendered
+// The manifest it replaces is kept with the previous generation, so that
+// 'morio template rollback' can restore it along with the configuration.
+func WriteManifests(rendered []renderedTarget, varsHash string) error {
+	manifests := make(map[string]*renderManifest)
+	var agents []string
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, target := range rendered {
+		manifest, found := manifests[target.Agent]
+		if !found {
+			manifest = &renderManifest{Agent: target.Agent, RenderedAt: now, Files: []manifestFile{}}
+			manifests[target.Agent] = manifest
+			agents = append(agents, target.Agent)
+		}
+		for _, file := range target.Files {
+			manifest.Files = append(manifest.Files, manifestFile{
+				Path:     file.To,
+				Source:   file.From,
+				VarsHash: varsHash,
+				Hash:     sha256Hex(file.Content),
+				Partials: file.Partials,
+			})
+		}
+	}
+
+	for _, agent := range agents {
+		if err := os.MkdirAll(filepath.Dir(previousManifestFile(agent)), 0755); err != nil {
+			return GenericError(err, "unable to create %s", filepath.Dir(previousManifestFile(agent)))
+		}
+		if err := renameIfExists(ManifestFile(agent), previousManifestFile(agent)); err != nil {
+			return GenericError(err, "unable to keep the previous manifest of %s", agent)
+		}
+		data, err := json.MarshalIndent(manifests[agent], "", "  ")
+		if err != nil {
+			return GenericError(err, "unable to serialize the manifest of %s", agent)
+		}
+		if err := os.MkdirAll(ManifestFolder(), 0755); err != nil {
+			return GenericError(err, "unable to create %s", ManifestFolder())
+		}
+		if err := WriteFileAtomic(ManifestFile(agent), append(data, '\n'), 0644); err != nil {
+			return GenericError(err, "unable to write the manifest to %s", ManifestFile(agent))
+		}
+	}
+
+	return nil
+}
+
+// Reads the manifest of an agent
+// Returns nil if the agent was never rendered.
+func ReadManifest(agent string) (*renderManifest, error) {
+	data, err := os.ReadFile(ManifestFile(agent))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ConfigError(err, "unable to read the manifest at %s", ManifestFile(agent))
+	}
+	var manifest renderManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, ConfigError(err, "unable to parse the manifest at %s", ManifestFile(agent))
+	}
+
+	return &manifest, nil
+}
+
+// Swaps in the manifest of the previous generation of an agent
+func rollbackManifest(agent string) error {
+	previous := previousManifestFile(agent)
+	if _, err := os.Lstat(previous); err != nil {
+		// Without a manifest for the previous generation, the current one is no longer accurate
+		return removeIfExists(ManifestFile(agent))
+	}
+	if _, err := os.Lstat(ManifestFile(agent)); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(ManifestFolder(), 0755); err != nil {
+			return err
+		}
+		return os.Rename(previous, ManifestFile(agent))
+	}
+
+	return exchangePaths(previous, ManifestFile(agent))
+}
+
+// Removes a file, unless it does not exist
+func removeIfExists(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
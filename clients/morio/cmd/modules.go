@@ -22,32 +22,38 @@ var modulesListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List modules",
 	Long:  `List client modules.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		ShowModulesList()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ShowModulesList()
 	},
 }
 
 // morio modules enable
 var modulesEnableCmd = &cobra.Command{
-	Use:   "enable [module-name]",
-	Short: "Enable a module",
-	Long:  `Enables a client module.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		enableModule(args[0])
-		ShowModulesList()
+	Use:         "enable [module-name]",
+	Short:       "Enable a module",
+	Long:        `Enables a client module.`,
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := enableModule(args[0]); err != nil {
+			return err
+		}
+		return ShowModulesList()
 	},
 }
 
 // morio modules disable
 var modulesDisableCmd = &cobra.Command{
-	Use:   "disable [module-name]",
-	Short: "Disable a module",
-	Long:  `Disables a client module.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		disableModule(args[0])
-		ShowModulesList()
+	Use:         "disable [module-name]",
+	Short:       "Disable a module",
+	Long:        `Disables a client module.`,
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := disableModule(args[0]); err != nil {
+			return err
+		}
+		return ShowModulesList()
 	},
 }
 
@@ -58,8 +64,8 @@ var modulesInfoCmd = &cobra.Command{
 	Long:    `Shows info about a client module.`,
 	Args:    cobra.ExactArgs(1),
 	Example: `  morio module info linux-system`,
-	Run: func(cmd *cobra.Command, args []string) {
-		ModuleInfo(args[0])
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ModuleInfo(args[0])
 	},
 }
 
@@ -72,10 +78,16 @@ func init() {
 	modulesCmd.AddCommand(modulesInfoCmd)
 }
 
-func ShowModuleList(agent string) {
-	enabled, disabled := ModuleList(agent + "/module-templates.d")
+func ShowModuleList(agent string) error {
+	enabled, disabled, err := ModuleList(agent + "/module-templates.d")
+	if err != nil {
+		return err
+	}
 	if agent == "logs" {
-		enabledInputs, disabledInputs := ModuleList(agent + "/input-templates.d")
+		enabledInputs, disabledInputs, err := ModuleList(agent + "/input-templates.d")
+		if err != nil {
+			return err
+		}
 		enabled = joinUnique(enabled, enabledInputs)
 		disabled = joinUnique(disabled, disabledInputs)
 	}
@@ -84,7 +96,15 @@ func ShowModuleList(agent string) {
 	} else {
 		fmt.Println("Enabled " + agent + " modules:")
 		for _, name := range enabled {
-			fmt.Println(" - " + ModuleNameFromFile(name))
+			condition, err := moduleUnmetCondition(agent, name)
+			if err != nil {
+				return err
+			}
+			if condition != "" {
+				fmt.Println(" - " + ModuleNameFromFile(name) + " (inactive: condition " + condition + " false)")
+			} else {
+				fmt.Println(" - " + ModuleNameFromFile(name))
+			}
 		}
 	}
 	if len(disabled) == 0 {
@@ -96,22 +116,45 @@ func ShowModuleList(agent string) {
 		}
 	}
 	fmt.Println()
+
+	return nil
+}
+
+// Returns the first condition of an enabled module that does not hold
+func moduleUnmetCondition(agent, file string) (string, error) {
+	for _, folder := range moduleTemplateFolders {
+		if !strings.HasPrefix(folder, agent+"/") {
+			continue
+		}
+		if _, err := os.Stat(GetConfigPath(folder, file)); err != nil {
+			continue
+		}
+		condition, err := TemplateUnmetCondition(folder + "/" + file)
+		if err != nil || condition != "" {
+			return condition, err
+		}
+	}
+
+	return "", nil
 }
 
-func ShowModulesList() {
-	ShowModuleList("audit")
-	ShowModuleList("logs")
-	ShowModuleList("metrics")
+func ShowModulesList() error {
+	for _, agent := range []string{"audit", "logs", "metrics"} {
+		if err := ShowModuleList(agent); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func ModuleList(folder string) ([]string, []string) {
+func ModuleList(folder string) ([]string, []string, error) {
 	var enabled []string
 	var disabled []string
 	path := GetConfigPath(folder)
 	templates, err := os.ReadDir(path)
 	if err != nil {
-		fmt.Println("Unable to load template list from " + path)
-		panic(err)
+		return nil, nil, ConfigError(err, "unable to load template list from %s", path)
 	}
 
 	for _, template := range templates {
@@ -126,65 +169,69 @@ func ModuleList(folder string) ([]string, []string) {
 		}
 	}
 
-	return enabled, disabled
-}
-
-func enableModule(module string) {
-	enableAuditModule(module)
-	enableLogsModule(module)
-	enableMetricsModule(module)
+	return enabled, disabled, nil
 }
 
-func enableAuditModule(module string) {
-	enableModuleFile("audit/module-templates.d", module)
+// All folders that hold module templates
+var moduleTemplateFolders = []string{
+	"audit/module-templates.d",
+	"logs/input-templates.d",
+	"logs/module-templates.d",
+	"metrics/module-templates.d",
 }
 
-func enableLogsModule(module string) {
-	enableModuleFile("logs/input-templates.d", module)
-	enableModuleFile("logs/module-templates.d", module)
-}
+func enableModule(module string) error {
+	for _, folder := range moduleTemplateFolders {
+		if err := enableModuleFile(folder, module); err != nil {
+			return err
+		}
+	}
 
-func enableMetricsModule(module string) {
-	enableModuleFile("metrics/module-templates.d", module)
+	return nil
 }
 
-func enableModuleFile(base, module string) {
-	_, disabled := ModuleList(base)
+func enableModuleFile(base, module string) error {
+	_, disabled, err := ModuleList(base)
+	if err != nil {
+		return err
+	}
 	for _, name := range disabled {
 		moduleName := ModuleNameFromFile(name)
 		if moduleName == module {
-			os.Rename(GetConfigPath(base+"/"+name), GetConfigPath(base+"/"+moduleName+".yml"))
+			if err := os.Rename(GetConfigPath(base+"/"+name), GetConfigPath(base+"/"+moduleName+".yml")); err != nil {
+				return GenericError(err, "failed to enable module %s", module)
+			}
 		}
 	}
-}
 
-func disableModule(module string) {
-	disableAuditModule(module)
-	disableLogsModule(module)
-	disableMetricsModule(module)
+	return nil
 }
 
-func disableAuditModule(module string) {
-	disableModuleFile("audit/module-templates.d", module)
-}
-
-func disableLogsModule(module string) {
-	disableModuleFile("logs/input-templates.d", module)
-	disableModuleFile("logs/module-templates.d", module)
-}
+func disableModule(module string) error {
+	for _, folder := range moduleTemplateFolders {
+		if err := disableModuleFile(folder, module); err != nil {
+			return err
+		}
+	}
 
-func disableMetricsModule(module string) {
-	disableModuleFile("metrics/module-templates.d", module)
+	return nil
 }
 
-func disableModuleFile(base, module string) {
-	enabled, _ := ModuleList(base)
+func disableModuleFile(base, module string) error {
+	enabled, _, err := ModuleList(base)
+	if err != nil {
+		return err
+	}
 	for _, name := range enabled {
 		moduleName := ModuleNameFromFile(name)
 		if moduleName == module {
-			os.Rename(GetConfigPath(base+"/"+moduleName+".yml"), GetConfigPath(base+"/"+moduleName+".yml.disabled"))
+			if err := os.Rename(GetConfigPath(base+"/"+moduleName+".yml"), GetConfigPath(base+"/"+moduleName+".yml.disabled")); err != nil {
+				return GenericError(err, "failed to disable module %s", module)
+			}
 		}
 	}
+
+	return nil
 }
 
 func ModuleNameFromFile(file string) string {
@@ -198,34 +245,53 @@ func ModuleNameFromFile(file string) string {
 	}
 }
 
-func ModuleInfo(module string) {
-	AuditModuleInfo(module, true)
-	LogsModuleInfo(module, false)
-	MetricsModuleInfo(module, false)
+func ModuleInfo(module string) error {
+	if err := AuditModuleInfo(module, true); err != nil {
+		return err
+	}
+	if err := LogsModuleInfo(module, false); err != nil {
+		return err
+	}
+	return MetricsModuleInfo(module, false)
 }
 
-func AuditModuleInfo(module string, printHeader bool) {
-	ModuleFileInfo("audit", "module-templates.d", module, printHeader)
+func AuditModuleInfo(module string, printHeader bool) error {
+	return ModuleFileInfo("audit", "module-templates.d", module, printHeader)
 }
 
-func LogsModuleInfo(module string, printHeader bool) {
-	ModuleFileInfo("logs", "module-templates.d", module, printHeader)
-	ModuleFileInfo("logs", "input-templates.d", module, false)
+func LogsModuleInfo(module string, printHeader bool) error {
+	if err := ModuleFileInfo("logs", "module-templates.d", module, printHeader); err != nil {
+		return err
+	}
+	return ModuleFileInfo("logs", "input-templates.d", module, false)
 }
 
-func MetricsModuleInfo(module string, printHeader bool) {
-	ModuleFileInfo("metrics", "module-templates.d", module, printHeader)
+func MetricsModuleInfo(module string, printHeader bool) error {
+	return ModuleFileInfo("metrics", "module-templates.d", module, printHeader)
 }
 
-func ModuleFileInfo(agent, folder, module string, printHeader bool) {
-	enabled, disabled := ModuleList(agent + "/" + folder)
+func ModuleFileInfo(agent, folder, module string, printHeader bool) error {
+	enabled, disabled, err := ModuleList(agent + "/" + folder)
+	if err != nil {
+		return err
+	}
 	for _, name := range enabled {
 		moduleName := ModuleNameFromFile(name)
 		if moduleName == module {
 			if printHeader == true {
-				PrintModuleInfoHeader(module, "enabled")
+				condition, err := TemplateUnmetCondition(agent + "/" + folder + "/" + name)
+				if err != nil {
+					return err
+				}
+				if condition != "" {
+					PrintModuleInfoHeader(module, "enabled (inactive: condition "+condition+" false)")
+				} else {
+					PrintModuleInfoHeader(module, "enabled")
+				}
+			}
+			if err := PrintModuleInfoData(agent, folder, name); err != nil {
+				return err
 			}
-			PrintModuleInfoData(agent, folder, name)
 		}
 	}
 	for _, name := range disabled {
@@ -234,9 +300,13 @@ func ModuleFileInfo(agent, folder, module string, printHeader bool) {
 			if printHeader == true {
 				PrintModuleInfoHeader(module, "disabled")
 			}
-			PrintModuleInfoData(agent, folder, name)
+			if err := PrintModuleInfoData(agent, folder, name); err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
 }
 
 func PrintModuleInfoHeader(module, status string) {
@@ -246,8 +316,11 @@ func PrintModuleInfoHeader(module, status string) {
 	fmt.Print()
 }
 
-func PrintModuleInfoData(agent, folder, file string) {
-	moriodata := TemplateDocsAsYaml(agent + "/" + folder + "/" + file)
+func PrintModuleInfoData(agent, folder, file string) error {
+	moriodata, err := TemplateDocsAsYaml(agent + "/" + folder + "/" + file)
+	if err != nil {
+		return err
+	}
 
 	// We want this in alphabetical order
 	sorted := make([]string, 0, len(moriodata))
@@ -273,6 +346,24 @@ func PrintModuleInfoData(agent, folder, file string) {
 			fmt.Print("\n    Version: ")
 			fmt.Println(val)
 		}
+		if key == "partials" {
+			fmt.Print("\n    Partials:")
+			if partials, ok := val.([]interface{}); ok {
+				for _, name := range partials {
+					fmt.Printf("\n      %v", name)
+				}
+			}
+		}
+		if key == "when" {
+			conditions, err := ParseConditions(val)
+			if err != nil {
+				return TemplateError(err, "invalid conditions in %s", GetConfigPath(agent, folder, file))
+			}
+			fmt.Print("\n    When:")
+			for _, name := range sortedKeys(conditions) {
+				fmt.Printf("\n      %s (%t)", FormatCondition(name, conditions[name]), ConditionHolds(name, conditions[name]))
+			}
+		}
 		if key == "vars" {
 			fmt.Print("\n    Vars:")
 			vars, ok := moriodata["vars"].(map[string]interface{})
@@ -291,6 +382,8 @@ func PrintModuleInfoData(agent, folder, file string) {
 			}
 		}
 	}
+
+	return nil
 }
 
 func joinUnique(slice1, slice2 []string) []string {
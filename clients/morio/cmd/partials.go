@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Partials are snippets in partials.d that templates can include by name
+// Mustache templates include them with {|> name|}, Go templates with
+// {{ template "name" . }}. They are rendered with the same vars.
+const partialsFolder string = "partials.d"
+
+// Returns the path to the file of a partial
+func PartialPath(name string) string {
+	return GetConfigPath(partialsFolder, name+".yml")
+}
+
+// Reads a partial from partials.d
+func ReadPartial(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", TemplateError(nil, "invalid partial name '%s'", name)
+	}
+	data, err := os.ReadFile(PartialPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", TemplateError(err, "partial %s not found at %s", name, PartialPath(name))
+	}
+	if err != nil {
+		return "", ConfigError(err, "unable to read partial at %s", PartialPath(name))
+	}
+
+	return string(data), nil
+}
+
+// Provides partials to mustache
+// Partials are parsed with the default delimiters, so ours are prepended.
+type partialProvider struct {
+	// The context the partials are rendered with
+	context map[string]interface{}
+}
+
+func (provider partialProvider) Get(name string) (string, error) {
+	partial, err := ReadPartial(name)
+	if err != nil {
+		return "", err
+	}
+
+	return templateDelimiters + unescapedVarTags(partial, provider.context), nil
+}
+
+var mustachePartialTag = regexp.MustCompile(`\{\|\s*>\s*([^|\s]+)\s*\|\}`)
+var goPartialTag = regexp.MustCompile(`\{\{-?\s*template\s+"([^"]+)"`)
+var goDefineTag = regexp.MustCompile(`\{\{-?\s*(?:define|block)\s+"([^"]+)"`)
+
+// Returns the partials that a template includes itself, in order
+// A Go template can define its own named templates, which are not partials.
+func includedPartials(template string) []string {
+	defined := make(map[string]bool)
+	for _, match := range goDefineTag.FindAllStringSubmatch(template, -1) {
+		defined[match[1]] = true
+	}
+	var names []string
+	for _, tag := range []*regexp.Regexp{mustachePartialTag, goPartialTag} {
+		for _, match := range tag.FindAllStringSubmatch(template, -1) {
+			if tag == goPartialTag && defined[match[1]] {
+				continue
+			}
+			names = append(names, match[1])
+		}
+	}
+
+	return names
+}
+
+// Returns all partials that a template uses, including those used by its partials
+func TemplatePartials(template string) ([]string, error) {
+	seen := make(map[string]bool)
+	queue := includedPartials(template)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		partial, err := ReadPartial(name)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, includedPartials(partial)...)
+	}
+
+	return sortedKeys(seen), nil
+}
+
+// Returns all partials that a template file uses
+func TemplateFilePartials(from string) ([]string, error) {
+	template, err := os.ReadFile(GetConfigPath(from))
+	if err != nil {
+		return nil, ConfigError(err, "failed to read template %s", GetConfigPath(from))
+	}
+
+	return TemplatePartials(string(template))
+}
+
+// Prints the config files that use the partials of the changed files
+// A change to a partial affects every file that includes it, so this shows
+// everything a partial touches, not only what changed.
+func printPartialUse(changes []configChange, rendered []renderedTarget) {
+	users := make(map[string][]string)
+	for _, target := range rendered {
+		for _, file := range target.Files {
+			for _, name := range file.Partials {
+				users[name] = append(users[name], file.To)
+			}
+		}
+	}
+	changed := make(map[string]bool)
+	for _, change := range changes {
+		for name, files := range users {
+			for _, to := range files {
+				if to == change.To {
+					changed[name] = true
+				}
+			}
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	fmt.Println("# partials")
+	for _, name := range sortedKeys(changed) {
+		files := users[name]
+		sort.Strings(files)
+		fmt.Printf("  %s is used by:\n", PartialPath(name))
+		for _, to := range files {
+			fmt.Printf("    %s\n", GetConfigPath(to))
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// morio processors
+var processorsCmd = &cobra.Command{
+	Use:   "processors",
+	Short: "Manage global processors",
+	Long: `Manages global processors.
+
+Global processors are added to every input that 'morio template' renders,
+after the processors of the template itself. They can be scoped to some
+agents or modules. Each set of processors is a file in processors.d, which
+is rendered with the same vars as the templates.
+
+After changing processors, run 'morio template' to apply the change.`,
+}
+
+// morio processors list
+var processorsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List global processors",
+	Long:    `Lists the global processors, along with the agents and modules they apply to.`,
+	Example: "  morio processors list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ShowProcessors()
+	},
+}
+
+// morio processors add
+var processorsAddCmd = &cobra.Command{
+	Use:   "add NAME PROCESSORS",
+	Short: "Add global processors",
+	Long: `Adds a set of global processors named NAME.
+
+PROCESSORS is a single processor, or a list of them, as YAML or JSON.
+It can use vars like a template does, and is stored as it is given, after
+checking that it renders with the current vars.
+Without --agent or --module, the processors are added to every input.
+With both, they are only added to inputs of the modules for those agents.`,
+	Example: `  morio processors add site 'add_labels: { labels: { site: "{|SITE_NAME|}" } }'
+  morio processors add no-debug --agent logs --module nginx 'drop_event: { when: { equals: { log.level: debug } } }'`,
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agents, _ := cmd.Flags().GetStringSlice("agent")
+		modules, _ := cmd.Flags().GetStringSlice("module")
+		return AddProcessors(args[0], args[1], agents, modules)
+	},
+}
+
+// morio processors rm
+var processorsRmCmd = &cobra.Command{
+	Use:         "rm NAME",
+	Short:       "Remove global processors",
+	Long:        `Removes the set of global processors named NAME.`,
+	Example:     "  morio processors rm site",
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return RemoveProcessors(args[0])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(processorsCmd)
+	processorsCmd.AddCommand(processorsAddCmd)
+	processorsCmd.AddCommand(processorsListCmd)
+	processorsCmd.AddCommand(processorsRmCmd)
+	processorsAddCmd.Flags().StringSlice("agent", nil, "only add the processors to inputs of this agent (audit, logs, or metrics)")
+	processorsAddCmd.Flags().StringSlice("module", nil, "only add the processors to inputs of this module")
+}
+
+// A set of global processors, as stored in processors.d
+type processorSet struct {
+	Name       string                   `yaml:"-"`
+	Agents     []string                 `yaml:"agents,omitempty"`
+	Modules    []string                 `yaml:"modules,omitempty"`
+	Processors []map[string]interface{} `yaml:"processors"`
+}
+
+// Checks whether a set of processors applies to an input of a module
+func (set processorSet) AppliesTo(agent, module string) bool {
+	return (len(set.Agents) == 0 || contains(set.Agents, agent)) && (len(set.Modules) == 0 || contains(set.Modules, module))
+}
+
+// Checks the scope and processors of a set
+func (set processorSet) Validate() error {
+	for _, agent := range set.Agents {
+		if !isAgent(agent) {
+			return ValidationError(nil, "unknown agent %s in processors %s, use audit, logs, or metrics", agent, set.Name)
+		}
+	}
+	if len(set.Processors) == 0 {
+		return ValidationError(nil, "processors %s has no processors", set.Name)
+	}
+	for _, processor := range set.Processors {
+		if len(processor) != 1 {
+			return ValidationError(nil, "each processor in %s should have a single key, like add_tags or drop_event", set.Name)
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, item string) bool {
+	for _, entry := range list {
+		if entry == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Location of the global processors
+func ProcessorsFolder() string {
+	return GetConfigPath("processors.d")
+}
+
+// Location of a set of global processors
+func ProcessorsFile(name string) string {
+	return filepath.Join(ProcessorsFolder(), name+".yml")
+}
+
+// Makes sure a name for processors is valid
+// Like a var name, it is used as a file name, so it has to stay inside its folder.
+func checkProcessorsName(name string) error {
+	if !validVarName.MatchString(name) {
+		return ValidationError(nil, "'%s' is not a valid name for processors", name)
+	}
+
+	return nil
+}
+
+// Lists the names of the sets of global processors, in the order they are applied
+func ListProcessors() ([]string, error) {
+	var names []string
+	entries, err := os.ReadDir(ProcessorsFolder())
+	if errors.Is(err, fs.ErrNotExist) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, ConfigError(err, "unable to read processors from %s", ProcessorsFolder())
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".yml" && entry.Name()[0] != '.' {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".yml"))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Parses a set of global processors
+func parseProcessorSet(name string, data string) (processorSet, error) {
+	set := processorSet{Name: name}
+	decoder := yaml.NewDecoder(bytes.NewBufferString(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&set); err != nil {
+		return set, ValidationError(err, "unable to parse processors %s", name)
+	}
+
+	return set, set.Validate()
+}
+
+// Loads the global processors that apply to the inputs of a template
+// The processors are rendered with the same vars as the template.
+func TemplateProcessors(from string, context map[string]interface{}) ([]map[string]interface{}, error) {
+	names, err := ListProcessors()
+	if err != nil {
+		return nil, err
+	}
+	agent := strings.SplitN(filepath.ToSlash(from), "/", 2)[0]
+	module := ModuleNameFromFile(from)
+	var processors []map[string]interface{}
+	for _, name := range names {
+		template, err := os.ReadFile(ProcessorsFile(name))
+		if err != nil {
+			return nil, ConfigError(err, "unable to read processors at %s", ProcessorsFile(name))
+		}
+		rendered, err := RenderTemplate(string(template), filepath.Join("processors.d", name+".yml"), context, StrictRendering())
+		if err != nil {
+			return nil, TemplateError(err, "failed to render %s", ProcessorsFile(name))
+		}
+		set, err := parseProcessorSet(name, rendered)
+		if err != nil {
+			return nil, err
+		}
+		if set.AppliesTo(agent, module) {
+			processors = append(processors, set.Processors...)
+		}
+	}
+
+	return processors, nil
+}
+
+// Returns the sets of global processors that use a var
+// Only their scope is parsed, without rendering them. When that fails, the
+// set is taken to apply to every input.
+func processorsUsingVar(name string) ([]processorSet, error) {
+	names, err := ListProcessors()
+	if err != nil {
+		return nil, err
+	}
+	var sets []processorSet
+	for _, setName := range names {
+		data, err := os.ReadFile(ProcessorsFile(setName))
+		if err != nil {
+			return nil, ConfigError(err, "unable to read processors at %s", ProcessorsFile(setName))
+		}
+		if !TemplateUsesVar(data, name) {
+			continue
+		}
+		set := processorSet{Name: setName}
+		var scope struct {
+			Agents  []string `yaml:"agents"`
+			Modules []string `yaml:"modules"`
+		}
+		if yaml.Unmarshal(data, &scope) == nil {
+			set.Agents, set.Modules = scope.Agents, scope.Modules
+		}
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// Appends the global processors to every input
+// This runs after AddDefaultProcessorsToInputs, so every input has a list of processors.
+func AddGlobalProcessorsToInputs(inputs []map[string]interface{}, processors []map[string]interface{}) []map[string]interface{} {
+	if len(processors) == 0 {
+		return inputs
+	}
+	for i := range inputs {
+		existing, _ := inputs[i]["processors"].([]map[string]interface{})
+		inputs[i]["processors"] = append(existing, processors...)
+	}
+
+	return inputs
+}
+
+// Prints the global processors
+func ShowProcessors() error {
+	names, err := ListProcessors()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Println("No global processors")
+		return nil
+	}
+	context, err := processorsContext()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(ProcessorsFile(name))
+		if err != nil {
+			return ConfigError(err, "unable to read processors at %s", ProcessorsFile(name))
+		}
+		// Show the processors as they are rendered with the current vars
+		rendered, err := RenderTemplate(string(data), filepath.Join("processors.d", name+".yml"), context, false)
+		if err != nil {
+			fmt.Printf("%s (invalid: %v)\n", name, err)
+			continue
+		}
+		set, err := parseProcessorSet(name, rendered)
+		if err != nil {
+			fmt.Printf("%s (invalid: %v)\n", name, err)
+			continue
+		}
+		scope := "all inputs"
+		if len(set.Agents) > 0 || len(set.Modules) > 0 {
+			var parts []string
+			if len(set.Agents) > 0 {
+				parts = append(parts, "agents: "+strings.Join(set.Agents, ", "))
+			}
+			if len(set.Modules) > 0 {
+				parts = append(parts, "modules: "+strings.Join(set.Modules, ", "))
+			}
+			scope = strings.Join(parts, "; ")
+		}
+		fmt.Printf("%s (%s)\n", name, scope)
+		for _, line := range strings.Split(strings.TrimRight(renderedProcessors(rendered), "\n"), "\n") {
+			fmt.Println("  " + line)
+		}
+	}
+
+	return nil
+}
+
+// Builds the context that global processors are shown and checked with
+// Vars are typed as they are for 'morio template', but secrets stay sealed.
+func processorsContext() (map[string]interface{}, error) {
+	vars, err := GetVars()
+	if err != nil {
+		return nil, err
+	}
+	AddHostFacts(vars)
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		return nil, err
+	}
+
+	return TypedContext(vars, declarations), nil
+}
+
+// Returns the processors of a rendered set as they are written
+// Going through a yaml.Node keeps their style and comments.
+func renderedProcessors(rendered string) string {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(rendered), &doc); err != nil || len(doc.Content) == 0 {
+		return rendered
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "processors" {
+			continue
+		}
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(root.Content[i+1]); err != nil {
+			return rendered
+		}
+		return buf.String()
+	}
+
+	return rendered
+}
+
+// Adds a set of global processors
+// The processors are stored as they are given, so they can use tags like
+// {|SITE|}. They are rendered with the current vars to check them first.
+func AddProcessors(name string, processors string, agents []string, modules []string) error {
+	if err := checkProcessorsName(name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(ProcessorsFile(name)); err == nil {
+		return ValidationError(nil, "processors %s already exist, remove them first", name)
+	}
+	context, err := processorsContext()
+	if err != nil {
+		return err
+	}
+	from := filepath.Join("processors.d", name+".yml")
+	rendered, err := RenderTemplate(processors, from, context, StrictRendering())
+	if err != nil {
+		return TemplateError(err, "unable to render processors %s", name)
+	}
+	parsed, err := parseYAMLValue(rendered)
+	if err != nil {
+		return ValidationError(err, "processors should be YAML or JSON")
+	}
+	// A single processor becomes the only item of the list
+	var list string
+	switch p := parsed.(type) {
+	case map[string]interface{}:
+		list = "  - " + indentLines(strings.TrimSpace(processors), "    ")
+	case []interface{}:
+		for _, item := range p {
+			if _, ok := item.(map[string]interface{}); !ok {
+				return ValidationError(nil, "each processor should be a map, like add_tags: { tags: [ web ] }")
+			}
+		}
+		list = "  " + indentLines(strings.TrimSpace(processors), "  ")
+	default:
+		return ValidationError(nil, "processors should be a map or a list of maps")
+	}
+
+	var scope bytes.Buffer
+	encoder := yaml.NewEncoder(&scope)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(processorSet{Agents: agents, Modules: modules}); err != nil {
+		return GenericError(err, "unable to serialize processors %s", name)
+	}
+	// Processors are marshalled as processors: [], so they are replaced by ours
+	data := strings.Replace(scope.String(), "processors: []\n", "processors:\n"+list+"\n", 1)
+	rendered, err = RenderTemplate(data, from, context, StrictRendering())
+	if err != nil {
+		return TemplateError(err, "unable to render processors %s", name)
+	}
+	if _, err := parseProcessorSet(name, rendered); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ProcessorsFolder(), 0755); err != nil {
+		return GenericError(err, "unable to create %s", ProcessorsFolder())
+	}
+	if err := WriteFileAtomic(ProcessorsFile(name), []byte(data), 0644); err != nil {
+		return GenericError(err, "unable to write processors to %s", ProcessorsFile(name))
+	}
+	fmt.Println("Added processors " + name + ". Run 'morio template' to apply them.")
+
+	return nil
+}
+
+// Indents every line of text but the first
+func indentLines(text string, indent string) string {
+	return strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+// Removes a set of global processors
+func RemoveProcessors(name string) error {
+	if err := checkProcessorsName(name); err != nil {
+		return err
+	}
+	err := os.Remove(ProcessorsFile(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ConfigError(err, "processors %s do not exist", name)
+	}
+	if err != nil {
+		return GenericError(err, "unable to remove processors %s", name)
+	}
+	fmt.Println("Removed processors " + name + ". Run 'morio template' to apply the change.")
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"testing"
+)
+
+// Names of processors are used as file names, so they should never reach outside their folder
+func TestProcessorsNameTraversal(t *testing.T) {
+	useTestRoot(t)
+	writeTestFile(t, "keep.yml", "keep")
+	name := "../keep"
+
+	checks := map[string]func() error{
+		"add": func() error { return AddProcessors(name, "- drop_fields: { fields: [a] }", nil, nil) },
+		"rm":  func() error { return RemoveProcessors(name) },
+	}
+	for check, run := range checks {
+		if err := run(); ExitCode(err) != ExitInvalidVar {
+			t.Errorf("%s: got %v, want an invalid var error", check, err)
+		}
+	}
+	if got := readTestFile(t, "keep.yml"); got != "keep" {
+		t.Errorf("keep.yml was changed to %q", got)
+	}
+}
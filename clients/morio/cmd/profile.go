@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// morio profile
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage var profiles",
+	Long: `Manages var profiles.
+
+A profile is a named set of vars (like prod, test, or dev) that sits
+between the default vars and the custom vars. When a profile is active,
+its vars override the defaults, while custom vars still override the
+profile.
+
+After switching profiles, run 'morio template' to apply the change.`,
+}
+
+// morio profile list
+var profileListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List profiles",
+	Long:    `Lists all profiles. The active profile is marked with a *.`,
+	Example: "  morio profile list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := ListProfiles()
+		if err != nil {
+			return err
+		}
+		if len(profiles) == 0 {
+			fmt.Println("No profiles")
+			return nil
+		}
+		active := ActiveProfile()
+		for _, name := range profiles {
+			if name == active {
+				fmt.Println("* " + name)
+			} else {
+				fmt.Println("  " + name)
+			}
+		}
+		return nil
+	},
+}
+
+// morio profile create
+var profileCreateCmd = &cobra.Command{
+	Use:   "create NAME [file_path]",
+	Short: "Create a profile",
+	Long: `Creates a new profile.
+
+If you pass it a JSON, YAML, or dotenv file, the vars in that file
+will be added to the profile. See 'morio vars import' for the format.`,
+	Example: `  morio profile create prod
+  morio profile create test ~/test-vars.yml`,
+	Annotations: mutating,
+	Args:        cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := CreateProfile(args[0]); err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return nil
+		}
+		vars, err := ReadVarsFile(args[1], "")
+		if err != nil {
+			return err
+		}
+		return SetProfileVars(args[0], vars)
+	},
+}
+
+// morio profile set
+var profileSetCmd = &cobra.Command{
+	Use:         "set PROFILE NAME value",
+	Short:       "Set the value of a var in a profile",
+	Long:        `Stores a new value for a template variable in a profile.`,
+	Example:     "  morio profile set prod MORIO_TICK 60s",
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[1]); err != nil {
+			return err
+		}
+		return SetProfileVars(args[0], map[string]string{args[1]: args[2]})
+	},
+}
+
+// morio profile rm
+var profileRmCmd = &cobra.Command{
+	Use:         "rm PROFILE NAME",
+	Short:       "Remove a var from a profile",
+	Long:        `Removes a template variable from a profile.`,
+	Example:     "  morio profile rm prod MORIO_TICK",
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkProfile(args[0]); err != nil {
+			return err
+		}
+		if err := checkVarName(args[1]); err != nil {
+			return err
+		}
+		err := os.Remove(filepath.Join(ProfileFolder(args[0]), args[1]))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return GenericError(err, "unable to remove var from profile")
+		}
+		return nil
+	},
+}
+
+// morio profile show
+var profileShowCmd = &cobra.Command{
+	Use:   "show [NAME]",
+	Short: "Show the vars in a profile",
+	Long: `Shows the vars in profile NAME.
+Without NAME, this shows the vars in the active profile.`,
+	Example: `  morio profile show
+  morio profile show prod`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := ActiveProfile()
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if name == "" {
+			return GenericError(nil, "no profile is active")
+		}
+		if err := checkProfile(name); err != nil {
+			return err
+		}
+		vars, err := GetProfileVars(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Profile: " + name)
+		for _, key := range SortedVarNames(vars) {
+			fmt.Printf("%s: %v\n", key, DisplayValue(vars[key]))
+		}
+		return nil
+	},
+}
+
+// morio profile use
+var profileUseCmd = &cobra.Command{
+	Use:   "use NAME",
+	Short: "Activate a profile",
+	Long: `Makes profile NAME the active profile.
+Use --none to deactivate the active profile.
+
+Run 'morio template' afterwards to apply the change.`,
+	Example: `  morio profile use prod
+  morio profile use --none`,
+	Annotations: mutating,
+	Args:        cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		none, _ := cmd.Flags().GetBool("none")
+		if none {
+			return UseProfile("")
+		}
+		if len(args) == 0 {
+			return GenericError(nil, "specify the profile to use, or --none")
+		}
+		return UseProfile(args[0])
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileCreateCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileRmCmd)
+	profileCmd.AddCommand(profileSetCmd)
+	profileCmd.AddCommand(profileShowCmd)
+	profileCmd.AddCommand(profileUseCmd)
+	profileUseCmd.Flags().Bool("none", false, "deactivate the active profile")
+}
+
+// Location of the profiles
+func ProfilesFolder() string {
+	return GetConfigPath("profiles.d")
+}
+
+// Location of the vars of a profile
+func ProfileFolder(name string) string {
+	return filepath.Join(ProfilesFolder(), name)
+}
+
+// Location of the file that holds the name of the active profile
+func ActiveProfileFile() string {
+	return GetConfigPath("active-profile")
+}
+
+// Returns the name of the active profile, or an empty string if there is none
+func ActiveProfile() string {
+	name, err := os.ReadFile(ActiveProfileFile())
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(name))
+}
+
+// Lists all profiles
+func ListProfiles() ([]string, error) {
+	var profiles []string
+	entries, err := os.ReadDir(ProfilesFolder())
+	if errors.Is(err, fs.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, ConfigError(err, "unable to read profiles")
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name()[0] != '.' {
+			profiles = append(profiles, entry.Name())
+		}
+	}
+
+	return profiles, nil
+}
+
+// Makes sure a profile exists
+func checkProfile(name string) error {
+	if !validVarName.MatchString(name) {
+		return ValidationError(nil, "'%s' is not a valid profile name", name)
+	}
+	info, err := os.Stat(ProfileFolder(name))
+	if err != nil || !info.IsDir() {
+		return ConfigError(err, "profile %s does not exist", name)
+	}
+
+	return nil
+}
+
+// Creates a new (empty) profile
+func CreateProfile(name string) error {
+	if !validVarName.MatchString(name) {
+		return GenericError(nil, "'%s' is not a valid profile name", name)
+	}
+	if err := os.MkdirAll(ProfileFolder(name), 0755); err != nil {
+		return GenericError(err, "unable to create profile %s", name)
+	}
+
+	return nil
+}
+
+// Activates a profile, or deactivates the active profile if name is empty
+func UseProfile(name string) error {
+	if name == "" {
+		err := os.Remove(ActiveProfileFile())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return GenericError(err, "unable to deactivate profile")
+		}
+		fmt.Println("No profile is active")
+		return nil
+	}
+	if err := checkProfile(name); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(ActiveProfileFile(), []byte(name), 0644); err != nil {
+		return GenericError(err, "unable to activate profile %s", name)
+	}
+	fmt.Println("Profile " + name + " is now active. Run 'morio template' to apply it.")
+
+	return nil
+}
+
+// Reads all vars in a profile
+func GetProfileVars(name string) (map[string]string, error) {
+	vars := make(map[string]string)
+	names, err := ListVarNames(ProfileFolder(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range names {
+		value, err := os.ReadFile(filepath.Join(ProfileFolder(name), key))
+		if err != nil {
+			return nil, ConfigError(err, "unable to read var %s from profile %s", key, name)
+		}
+		vars[key] = string(value)
+	}
+
+	return vars, nil
+}
+
+// Validates vars and writes them to a profile
+// Secret vars are sealed before they are written.
+func SetProfileVars(name string, vars map[string]string) error {
+	if err := checkProfile(name); err != nil {
+		return err
+	}
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		return err
+	}
+	vars = normalizeVarValues(vars, declarations)
+	if err := ValidateVars(vars, declarations); err != nil {
+		return err
+	}
+	for key, value := range vars {
+		if IsSecretVar(key, declarations) {
+			value, err = SealSecret(value)
+			if err != nil {
+				return err
+			}
+		}
+		if err := writeVarFile(filepath.Join(ProfileFolder(name), key), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
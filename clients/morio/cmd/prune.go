@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Default vars that are written by the Morio client itself,
+// rather than declared in a template
+var clientManagedVars = []string{"MORIO_CLIENT_UUID"}
+
+func isClientManagedVar(name string) bool {
+	for _, managed := range clientManagedVars {
+		if managed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Finds default vars that are no longer declared by the global vars or any
+// (enabled) template, and custom vars that are neither declared nor used
+func FindOrphanedVars(declarations map[string][]VarDeclaration) ([]string, []string, error) {
+	defaults, err := ListVarNames(DefaultVarFolder())
+	if err != nil {
+		return nil, nil, err
+	}
+	customs, err := ListVarNames(CustomVarFolder())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orphaned := func(names []string) []string {
+		var found []string
+		for _, name := range names {
+			if _, declared := declarations[name]; !declared && !isClientManagedVar(name) {
+				found = append(found, name)
+			}
+		}
+		sort.Strings(found)
+		return found
+	}
+
+	// Custom vars can be used without being declared, like in global processors
+	var unused []string
+	for _, name := range orphaned(customs) {
+		consumers, err := VarConsumers(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(consumers) == 0 {
+			unused = append(unused, name)
+		}
+	}
+
+	return orphaned(defaults), unused, nil
+}
+
+// Removes orphaned default vars, and flags orphaned custom vars
+// Custom vars are never removed, since they were set by a human.
+func PruneVars(declarations map[string][]VarDeclaration, dryRun bool) error {
+	defaults, customs, err := FindOrphanedVars(declarations)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range defaults {
+		if dryRun {
+			fmt.Println("Orphaned default var: " + name)
+			continue
+		}
+		err := os.Remove(filepath.Join(DefaultVarFolder(), name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return GenericError(err, "unable to remove orphaned default var %s", name)
+		}
+		fmt.Println("Removed orphaned default var: " + name)
+	}
+	for _, name := range customs {
+		fmt.Fprintf(os.Stderr, "Warning: custom var %s is not declared or used by any template (remove it with 'morio vars rm %s')\n", name, name)
+	}
+
+	return nil
+}
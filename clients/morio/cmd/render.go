@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cbroglie/mustache"
+	"github.com/spf13/viper"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Templates use {| |} as delimiters, since {{ }} clashes with the beats' own syntax
+const templateDelimiters string = "{{={| |}=}}"
+
+// A var that a template uses, but that is not defined
+type undefinedVar struct {
+	File string
+	Line int
+	Name string
+}
+
+// UndefinedVarsError lists the undefined vars that were found in strict mode
+type UndefinedVarsError struct {
+	Vars []undefinedVar
+}
+
+func (e *UndefinedVarsError) Error() string {
+	var lines []string
+	for _, v := range e.Vars {
+		if v.Line > 0 {
+			lines = append(lines, fmt.Sprintf("  %s:%d: %s is not defined", v.File, v.Line, v.Name))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s: %s is not defined", v.File, v.Name))
+		}
+	}
+
+	return "\n" + strings.Join(lines, "\n")
+}
+
+// Adds the undefined vars of err to e
+// Returns false if err is not caused by undefined vars.
+func (e *UndefinedVarsError) collect(err error) bool {
+	var undefined *UndefinedVarsError
+	if !errors.As(err, &undefined) {
+		return false
+	}
+	// Files that every template uses, like global processors, are reported once
+	for _, v := range undefined.Vars {
+		duplicate := false
+		for _, existing := range e.Vars {
+			if existing == v {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			e.Vars = append(e.Vars, v)
+		}
+	}
+
+	return true
+}
+
+// Checks whether templates are rendered in strict mode
+// This is the --strict flag of 'morio template', or strict in morio.yml
+func StrictRendering() bool {
+	return viper.GetBool("strict")
+}
+
+// Renders a template with mustache
+// In strict mode, using a var that is not defined is an error. Rendering
+// carries on to find all of them, so they can be reported at once.
+func RenderMustache(template string, from string, context map[string]interface{}, strict bool) (string, error) {
+	partials := partialProvider{context: context}
+	source := templateDelimiters + unescapedVarTags(template, context)
+	if !strict {
+		return mustache.RenderPartials(source, partials, context)
+	}
+
+	mustache.AllowMissingVariables = false
+	defer func() { mustache.AllowMissingVariables = true }()
+
+	undefined := &UndefinedVarsError{}
+	for {
+		output, err := mustache.RenderPartials(source, partials, context)
+		name, missing := missingVariable(err)
+		if !missing {
+			if err != nil {
+				return output, err
+			}
+			// Mustache skips a section whose var is not defined, rather than failing
+			for _, name := range sectionVars(template) {
+				if _, defined := context[name]; !defined {
+					undefined.Vars = append(undefined.Vars, undefinedVarUses(template, from, name)...)
+				}
+			}
+			if len(undefined.Vars) > 0 {
+				return "", undefined
+			}
+			return output, nil
+		}
+		// Render again with the var defined, to find the next one
+		undefined.Vars = append(undefined.Vars, undefinedVarUses(template, from, name)...)
+		if _, seen := context[name]; seen {
+			return "", undefined
+		}
+		context = withVar(context, name, "")
+	}
+}
+
+var missingVariablePattern = regexp.MustCompile(`^missing variable ("[^"]*")$`)
+
+// Returns the name of the var, if err is caused by a missing variable
+func missingVariable(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	match := missingVariablePattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", false
+	}
+	name, err := strconv.Unquote(match[1])
+	if err != nil {
+		return "", false
+	}
+
+	return name, true
+}
+
+// Returns where a template uses an undefined var
+// When the template does not use it itself, it comes from one of its partials.
+func undefinedVarUses(template string, from string, name string) []undefinedVar {
+	var uses []undefinedVar
+	for _, line := range templateVarLines(template, name) {
+		uses = append(uses, undefinedVar{File: GetConfigPath(from), Line: line, Name: name})
+	}
+	if len(uses) > 0 {
+		return uses
+	}
+	partials, _ := TemplatePartials(template)
+	for _, partialName := range partials {
+		partial, err := ReadPartial(partialName)
+		if err != nil {
+			continue
+		}
+		for _, line := range templateVarLines(partial, name) {
+			uses = append(uses, undefinedVar{File: PartialPath(partialName), Line: line, Name: name})
+		}
+	}
+	if len(uses) == 0 {
+		uses = append(uses, undefinedVar{File: GetConfigPath(from), Name: name})
+	}
+
+	return uses
+}
+
+// Returns the lines where a template uses a var as a variable or section tag
+func templateVarLines(template string, name string) []int {
+	tag := regexp.MustCompile(`\{\|\s*[&{#^]?\s*` + regexp.QuoteMeta(name) + `\s*\}?\s*\|\}`)
+	var lines []int
+	for i, line := range strings.Split(template, "\n") {
+		if tag.MatchString(line) {
+			lines = append(lines, i+1)
+		}
+	}
+
+	return lines
+}
+
+// A variable tag, like {|NAME|}
+var mustacheVarTag = regexp.MustCompile(`\{\|\s*([A-Za-z0-9_][A-Za-z0-9_.-]*)\s*\|\}`)
+
+// Rewrites the tags of vars that should not be HTML-escaped to {|&NAME|}
+// Mustache escapes {|NAME|}, which would change a secret like a&b into a&amp;b,
+// and the quotes of a list into &#34;.
+func unescapedVarTags(template string, context map[string]interface{}) string {
+	return mustacheVarTag.ReplaceAllStringFunc(template, func(tag string) string {
+		name := mustacheVarTag.FindStringSubmatch(tag)[1]
+		if rendersUnescaped(context[name]) {
+			return "{|&" + name + "|}"
+		}
+		return tag
+	})
+}
+
+// Checks whether a value in the render context is written without escaping
+func rendersUnescaped(value interface{}) bool {
+	switch value.(type) {
+	case secretValue, renderList, renderMap:
+		return true
+	}
+
+	return false
+}
+
+// A revealed secret in the render context
+type secretValue string
+
+// Checks whether rendered content holds a revealed secret
+func containsSecret(content string, context map[string]interface{}) bool {
+	for _, value := range context {
+		if secret, ok := value.(secretValue); ok && secret != "" && strings.Contains(content, string(secret)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var mustacheSectionTag = regexp.MustCompile(`\{\|\s*([#^/>])\s*([^|\s]+)\s*\|\}`)
+
+// Returns the vars that a template and its partials use as a section
+// Sections nested in another one are left out, since their names can be keys
+// of the items they loop over rather than vars.
+func sectionVars(template string) []string {
+	names := make(map[string]bool)
+	partials := make(map[string]bool)
+	var walk func(text string)
+	walk = func(text string) {
+		depth := 0
+		for _, match := range mustacheSectionTag.FindAllStringSubmatch(text, -1) {
+			switch match[1] {
+			case "#", "^":
+				if depth == 0 {
+					names[strings.SplitN(match[2], ".", 2)[0]] = true
+				}
+				depth++
+			case "/":
+				depth--
+			case ">":
+				if depth == 0 && !partials[match[2]] {
+					partials[match[2]] = true
+					if partial, err := ReadPartial(match[2]); err == nil {
+						walk(partial)
+					}
+				}
+			}
+		}
+	}
+	walk(template)
+
+	return sortedKeys(names)
+}
+
+// Returns a copy of the context with an extra var
+func withVar(context map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(context)+1)
+	for key, val := range context {
+		copied[key] = val
+	}
+	copied[name] = value
+
+	return copied
+}
+
+// A list var in the render context
+// It can be looped over in a section, and renders as a (JSON) flow list.
+type renderList []interface{}
+
+func (list renderList) String() string {
+	return flowValue([]interface{}(list))
+}
+
+// A map var in the render context
+// Its keys can be used in a section, and it renders as a (JSON) flow map.
+type renderMap map[string]interface{}
+
+func (m renderMap) String() string {
+	return flowValue(map[string]interface{}(m))
+}
+
+// Renders a value as JSON, which is also valid YAML
+func flowValue(value interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+// Builds the render context from the (string) var values
+// Values are typed according to their declaration, so that false, 0, and
+// empty lists are falsy in a section, and lists can be looped over.
+// Vars that are not declared, or declared without a type, are strings, apart
+// from true, false, and whole numbers, so that false and 0 are falsy too.
+func TypedContext(vars map[string]string, declarations map[string][]VarDeclaration) map[string]interface{} {
+	context := make(map[string]interface{}, len(vars))
+	for key, value := range vars {
+		varType := ""
+		if decls := declarations[key]; len(decls) > 0 && (decls[0].HasType || decls[0].Type != "string") {
+			varType = decls[0].Type
+		}
+		context[key] = typedValue(value, varType)
+	}
+
+	return context
+}
+
+// Types a var value for the render context
+func typedValue(value string, varType string) interface{} {
+	switch varType {
+	case "bool":
+		if b, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			return b
+		}
+	case "int":
+		if i, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && strconv.Itoa(i) == strings.TrimSpace(value) {
+			return i
+		}
+	case "list":
+		if list, ok := parseFlowValue(value).([]interface{}); ok {
+			return renderList(list)
+		}
+	case "map":
+		if m, ok := parseFlowValue(value).(map[string]interface{}); ok {
+			return renderMap(m)
+		}
+	case "":
+		// These render the same as the string they replace
+		if value == "true" || value == "false" {
+			return value == "true"
+		}
+		if i, err := strconv.Atoi(value); err == nil && strconv.Itoa(i) == value {
+			return i
+		}
+	}
+
+	return value
+}
+
+// Parses a value as YAML, returning nil if it is not valid
+// An empty value is an empty list.
+func parseFlowValue(value string) interface{} {
+	if strings.TrimSpace(value) == "" {
+		return []interface{}{}
+	}
+	parsed, err := parseYAMLValue(value)
+	if err != nil {
+		return nil
+	}
+
+	return parsed
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestRenderMustacheTypedList(t *testing.T) {
+	declarations := map[string][]VarDeclaration{
+		"PATHS":  {{Name: "PATHS", Type: "list"}},
+		"LABELS": {{Name: "LABELS", Type: "map"}},
+	}
+	context := TypedContext(map[string]string{
+		"PATHS":  `["/var/log/a.log","/var/log/b.log"]`,
+		"LABELS": `{"site":"brussels"}`,
+	}, declarations)
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"paths: {|PATHS|}", `paths: ["/var/log/a.log","/var/log/b.log"]`},
+		{"paths: {| PATHS |}", `paths: ["/var/log/a.log","/var/log/b.log"]`},
+		{"paths: {|{PATHS}|}", `paths: ["/var/log/a.log","/var/log/b.log"]`},
+		{"paths: {|&PATHS|}", `paths: ["/var/log/a.log","/var/log/b.log"]`},
+		{"labels: {|LABELS|}", `labels: {"site":"brussels"}`},
+		{"{|#PATHS|}- {|.|}\n{|/PATHS|}", "- /var/log/a.log\n- /var/log/b.log\n"},
+	}
+	for _, test := range tests {
+		got, err := RenderMustache(test.template, "test.yml", context, false)
+		if err != nil {
+			t.Fatalf("rendering %q: %v", test.template, err)
+		}
+		if got != test.want {
+			t.Errorf("rendering %q: got %q, want %q", test.template, got, test.want)
+		}
+	}
+}
+
+// A global var without a type is a list if its default is one
+func TestRenderMustacheGlobalListDefault(t *testing.T) {
+	useTestRoot(t)
+	writeTestFile(t, "global-vars.yml", "MORIO_PATHS:\n  dflt: [ /var/log/a.log, /var/log/b.log ]\n")
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := declarations["MORIO_PATHS"][0].Type; got != "list" {
+		t.Errorf("got type %s, want list", got)
+	}
+	globals, err := ReadGlobalVars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := TypedContext(ExtractDefaultsFromVars(globals), declarations)
+
+	got, err := RenderMustache("paths: {|MORIO_PATHS|}", "test.yml", context, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `paths: ["/var/log/a.log","/var/log/b.log"]`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTypedContextUndeclared(t *testing.T) {
+	declarations := map[string][]VarDeclaration{
+		"ENABLED": {{Name: "ENABLED", Type: "bool", HasType: true}},
+		"PORT":    {{Name: "PORT", Type: "int", HasType: true}},
+		"NAME":    {{Name: "NAME", Type: "string", HasType: true}},
+		"DEBUG":   {{Name: "DEBUG", Type: "string"}},
+	}
+	context := TypedContext(map[string]string{
+		"ENABLED":  "false",
+		"PORT":     "8080",
+		"NAME":     "false",
+		"DEBUG":    "false",
+		"VERSION":  "1",
+		"FLAG":     "true",
+		"SELECTOR": "[a, b]",
+		"ZIP":      "007",
+	}, declarations)
+
+	if context["ENABLED"] != false {
+		t.Errorf("ENABLED: got %#v, want false", context["ENABLED"])
+	}
+	if context["PORT"] != 8080 {
+		t.Errorf("PORT: got %#v, want 8080", context["PORT"])
+	}
+	if context["NAME"] != "false" {
+		t.Errorf("NAME: got %#v, want the string it is declared as", context["NAME"])
+	}
+	// Vars that are not declared, or declared without a type, are only typed
+	// when they render the same
+	for name, want := range map[string]interface{}{"DEBUG": false, "VERSION": 1, "FLAG": true, "SELECTOR": "[a, b]", "ZIP": "007"} {
+		if context[name] != want {
+			t.Errorf("%s: got %#v, want %#v", name, context[name], want)
+		}
+	}
+}
+
+func TestRenderMustacheUndeclaredFalsy(t *testing.T) {
+	context := TypedContext(map[string]string{"DEBUG": "false", "LEVEL": "0", "EMPTY": "", "FLAG": "true"}, nil)
+	template := "{|#DEBUG|}a{|/DEBUG|}{|#LEVEL|}b{|/LEVEL|}{|#EMPTY|}c{|/EMPTY|}{|#FLAG|}d{|/FLAG|} {|DEBUG|} {|LEVEL|}"
+	got, err := RenderMustache(template, "test.yml", context, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d false 0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderMustacheStrictUndefined(t *testing.T) {
+	template := "a: {|X|}\n{|#DEBUG|}\nb: {|Y|}\n{|/DEBUG|}\n{|^QUIET|}c: 1{|/QUIET|}\n{|#ITEMS|}{|#enabled|}d: 1{|/enabled|}{|/ITEMS|}\n"
+	context := map[string]interface{}{
+		"ITEMS": renderList{map[string]interface{}{"enabled": true}},
+	}
+	_, err := RenderMustache(template, "test.yml", context, true)
+	undefined, ok := err.(*UndefinedVarsError)
+	if !ok {
+		t.Fatalf("got %v, want undefined vars", err)
+	}
+
+	got := make(map[string]int)
+	for _, v := range undefined.Vars {
+		got[v.Name] = v.Line
+	}
+	// Y is inside the DEBUG section, which is skipped, and enabled is a key of the items
+	want := map[string]int{"X": 1, "DEBUG": 2, "QUIET": 5}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for name, line := range want {
+		if got[name] != line {
+			t.Errorf("%s: got line %d, want %d", name, got[name], line)
+		}
+	}
+	if _, found := context["X"]; found {
+		t.Errorf("the context should not be changed")
+	}
+}
+
+func TestRenderMustacheSecretUnescaped(t *testing.T) {
+	context := map[string]interface{}{
+		"PASSWORD": secretValue(`hunter2&<x>"`),
+		"NAME":     "a&b",
+	}
+	got, err := RenderMustache("pw: {|PASSWORD|}\nname: {|NAME|}", "test.yml", context, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "pw: hunter2&<x>\"\nname: a&amp;b"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !containsSecret(got, context) {
+		t.Errorf("the rendered content should hold the secret")
+	}
+}
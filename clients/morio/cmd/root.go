@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"path/filepath"
 )
 
 var configFile string
 
+// The default installation root of the Morio client
+const DefaultConfigRoot string = "/etc/morio"
+
 // This is the root command which will show the help
 // Other comands will add themselves as children of the root
 var RootCmd = &cobra.Command{
@@ -19,29 +24,65 @@ var RootCmd = &cobra.Command{
 This client wraps different agents that each gather one type
 of observability data and ship it to a Morio collector.
 
-Use this to manage the various agents and their configuration.`,
+Use this to manage the various agents and their configuration.
+
+Exit codes:
+  0  Success
+  1  General failure
+  2  Configuration missing or unreadable
+  3  Template error
+  4  Agent failure
+  5  Permission denied
+  6  Invalid or missing var value
+  7  Var is locked
+  8  Another morio process holds the config lock
+  9  The configuration differs from what is rendered, or from the manifest`,
+	SilenceErrors:     true,
+	SilenceUsage:      true,
+	PersistentPreRunE: lockForCommand,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := RootCmd.Execute()
+	ReleaseConfigLock()
 	if err != nil {
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(ExitCode(err))
 	}
 }
 
 // When starting up, initialize the config file
 func init() {
 	cobra.OnInitialize(initConfig)
+	RootCmd.PersistentFlags().String("root", DefaultConfigRoot, "installation root of the Morio client (or set MORIO_ROOT)")
+	viper.BindPFlag("root", RootCmd.PersistentFlags().Lookup("root"))
+	RootCmd.PersistentFlags().String("vars-file", "", "a JSON, YAML, or dotenv file with vars that override custom vars")
+	viper.BindPFlag("vars-file", RootCmd.PersistentFlags().Lookup("vars-file"))
+	RootCmd.PersistentFlags().Duration("lock-timeout", 0, "how long to wait for another morio process to release the config lock")
+	viper.BindPFlag("lock-timeout", RootCmd.PersistentFlags().Lookup("lock-timeout"))
 }
 
 // Set up viper to manage the config file
 func initConfig() {
 	viper.SetEnvPrefix("morio")
-	viper.AddConfigPath("/etc/morio/")
+	viper.BindEnv("root")
+	viper.BindEnv("runtime")
+	viper.AddConfigPath(GetConfigRoot())
 	viper.SetConfigType("yaml")
 	viper.SetConfigName("morio")
 	viper.AutomaticEnv()
 	viper.ReadInConfig()
 }
+
+// Returns the installation root that all paths resolve through
+// This is the --root flag, or MORIO_ROOT, or /etc/morio
+func GetConfigRoot() string {
+	root := viper.GetString("root")
+	if root == "" {
+		return DefaultConfigRoot
+	}
+
+	return filepath.Clean(root)
+}
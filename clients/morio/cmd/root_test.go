@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Points the installation root to an empty installation for the duration of a test
+func useTestRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	folders := []string{"vars.d", "default.vars.d"}
+	for _, target := range renderTargets {
+		if target.Folder {
+			folders = append(folders, target.From)
+		}
+	}
+	for _, folder := range folders {
+		if err := os.MkdirAll(filepath.Join(root, folder), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viper.Set("root", root)
+	t.Cleanup(func() { viper.Set("root", "") })
+
+	return root
+}
+
+// Writes a file relative to the installation root
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(GetConfigPath(path)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(GetConfigPath(path), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads a file relative to the installation root
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(GetConfigPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
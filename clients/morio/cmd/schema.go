@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported var types
+// A var without a type is a plain string, unless its default is a list or map
+var varTypes = []string{"string", "bool", "int", "duration", "path", "list", "map", "enum", "secret"}
+
+// VarDeclaration holds the schema of a var as declared in moriodata.vars
+// (or in the global vars file). Source is the file that declares it.
+type VarDeclaration struct {
+	Name     string
+	Source   string
+	Info     string
+	Dflt     interface{}
+	HasDflt  bool
+	Type     string
+	HasType  bool
+	Enum     []string
+	Pattern  *regexp.Regexp
+	Min      *float64
+	Max      *float64
+	Required bool
+}
+
+// Var names are used as file names, so we only allow a safe subset
+var validVarName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// Makes sure a var name is valid
+// Var names are used as file names, so this also keeps them inside their folder.
+func checkVarName(name string) error {
+	if !validVarName.MatchString(name) {
+		return ValidationError(nil, "'%s' is not a valid var name", name)
+	}
+
+	return nil
+}
+
+// Parses a single var declaration
+func ParseVarDeclaration(name string, spec interface{}, source string) (VarDeclaration, error) {
+	decl := VarDeclaration{Name: name, Source: source, Type: "string"}
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return decl, nil
+	}
+	if info, ok := specMap["info"].(string); ok {
+		decl.Info = info
+	}
+	decl.Dflt, decl.HasDflt = specMap["dflt"]
+	if varType, ok := specMap["type"]; ok {
+		decl.Type, decl.HasType = fmt.Sprintf("%v", varType), true
+		if !isValidVarType(decl.Type) {
+			return decl, fmt.Errorf("var %s in %s has unsupported type '%s'", name, source, decl.Type)
+		}
+	} else {
+		// Without a type, a list or map default makes it a list or map var
+		switch decl.Dflt.(type) {
+		case []interface{}:
+			decl.Type = "list"
+		case map[string]interface{}:
+			decl.Type = "map"
+		}
+	}
+	if enum, ok := specMap["enum"].([]interface{}); ok {
+		for _, item := range enum {
+			decl.Enum = append(decl.Enum, fmt.Sprintf("%v", item))
+		}
+	}
+	if decl.Type == "enum" && len(decl.Enum) == 0 {
+		return decl, fmt.Errorf("var %s in %s is of type enum but has no enum values", name, source)
+	}
+	if pattern, ok := specMap["pattern"]; ok {
+		re, err := regexp.Compile(fmt.Sprintf("%v", pattern))
+		if err != nil {
+			return decl, fmt.Errorf("var %s in %s has an invalid pattern: %v", name, source, err)
+		}
+		decl.Pattern = re
+	}
+	for _, bound := range []string{"min", "max"} {
+		raw, ok := specMap[bound]
+		if !ok {
+			continue
+		}
+		val, err := boundToFloat(raw, decl.Type)
+		if err != nil {
+			return decl, fmt.Errorf("var %s in %s has an invalid %s: %v", name, source, bound, err)
+		}
+		if bound == "min" {
+			decl.Min = &val
+		} else {
+			decl.Max = &val
+		}
+	}
+	if required, ok := specMap["required"].(bool); ok {
+		decl.Required = required
+	}
+
+	return decl, nil
+}
+
+func isValidVarType(varType string) bool {
+	for _, t := range varTypes {
+		if t == varType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Converts a min or max bound to a number
+// For durations, the bound can be given as a duration string (eg: 5s)
+func boundToFloat(raw interface{}, varType string) (float64, error) {
+	switch v := raw.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		if varType == "duration" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return 0, err
+			}
+			return d.Seconds(), nil
+		}
+		return strconv.ParseFloat(v, 64)
+	}
+
+	return 0, fmt.Errorf("%v is not a number", raw)
+}
+
+// Validates a value against the declaration
+// Empty values are only rejected for required vars.
+// Min and max apply to the value of an int, the seconds of a
+// duration, and the number of items in a list.
+func (decl VarDeclaration) Validate(value string) error {
+	if value == "" {
+		if decl.Required {
+			return fmt.Errorf("%s is required", decl.Name)
+		}
+		return nil
+	}
+	// Sealed secrets can only be validated before they are sealed
+	if IsSecretValue(value) {
+		return nil
+	}
+
+	var size float64
+	hasSize := false
+	switch decl.Type {
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s must be a bool (true or false), not '%s'", decl.Name, value)
+		}
+	case "int":
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, not '%s'", decl.Name, value)
+		}
+		size, hasSize = float64(num), true
+	case "duration":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration (eg: 30s), not '%s'", decl.Name, value)
+		}
+		size, hasSize = d.Seconds(), true
+	case "path":
+		if !filepath.IsAbs(value) {
+			return fmt.Errorf("%s must be an absolute path, not '%s'", decl.Name, value)
+		}
+	case "list":
+		parsed, err := parseYAMLValue(value)
+		list, ok := parsed.([]interface{})
+		if err != nil || !ok {
+			return fmt.Errorf("%s must be a list (eg: [ \"a\", \"b\" ]), not '%s'", decl.Name, value)
+		}
+		size, hasSize = float64(len(list)), true
+	case "map":
+		parsed, err := parseYAMLValue(value)
+		m, ok := parsed.(map[string]interface{})
+		if err != nil || !ok {
+			return fmt.Errorf("%s must be a map (eg: { \"a\": 1 }), not '%s'", decl.Name, value)
+		}
+		size, hasSize = float64(len(m)), true
+	}
+
+	if len(decl.Enum) > 0 {
+		allowed := false
+		for _, option := range decl.Enum {
+			if option == value {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s must be one of %s, not '%s'", decl.Name, strings.Join(decl.Enum, ", "), value)
+		}
+	}
+	if decl.Pattern != nil && !decl.Pattern.MatchString(value) {
+		return fmt.Errorf("%s must match pattern %s, not '%s'", decl.Name, decl.Pattern.String(), value)
+	}
+	if hasSize && decl.Min != nil && size < *decl.Min {
+		return fmt.Errorf("%s must be at least %v, not '%s'", decl.Name, *decl.Min, value)
+	}
+	if hasSize && decl.Max != nil && size > *decl.Max {
+		return fmt.Errorf("%s must be at most %v, not '%s'", decl.Name, *decl.Max, value)
+	}
+
+	return nil
+}
+
+// Collects the var declarations from the global vars and all (enabled) templates
+// A var can be declared in more than one place, so this returns a list per var.
+func GetVarDeclarations() (map[string][]VarDeclaration, error) {
+	declarations := make(map[string][]VarDeclaration)
+
+	add := func(vars map[string]interface{}, source string) error {
+		for name, spec := range vars {
+			decl, err := ParseVarDeclaration(name, spec, source)
+			if err != nil {
+				return TemplateError(err, "invalid var declaration")
+			}
+			declarations[name] = append(declarations[name], decl)
+		}
+		return nil
+	}
+
+	globals, err := ReadGlobalVars()
+	if err != nil {
+		return nil, err
+	}
+	if err := add(globals, GetConfigPath("global-vars.yml")); err != nil {
+		return nil, err
+	}
+
+	for _, folder := range moduleTemplateFolders {
+		templates, err := TemplateList(folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range templates {
+			moriodata, err := TemplateDocsAsYaml(folder + "/" + file)
+			if err != nil {
+				return nil, err
+			}
+			if vars, ok := moriodata["vars"].(map[string]interface{}); ok {
+				if err := add(vars, GetConfigPath(folder, file)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return declarations, nil
+}
+
+// Validates vars against their declarations
+// Vars that are not declared anywhere are not validated.
+func ValidateVars(vars map[string]string, declarations map[string][]VarDeclaration) error {
+	var problems []string
+	for name, value := range vars {
+		if !validVarName.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("'%s' is not a valid var name", name))
+			continue
+		}
+		if IsHostFact(name) {
+			problems = append(problems, fmt.Sprintf("%s is a read-only host fact", name))
+			continue
+		}
+		for _, decl := range declarations[name] {
+			if err := decl.Validate(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%v (declared in %s)", err, decl.Source))
+				break
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+
+	return ValidationError(nil, "invalid var value:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// Makes sure all required vars have a value
+func CheckRequiredVars(vars map[string]string, declarations map[string][]VarDeclaration) error {
+	var missing []string
+	for name, decls := range declarations {
+		for _, decl := range decls {
+			if decl.Required && vars[name] == "" {
+				missing = append(missing, fmt.Sprintf("%s (required by %s)", name, decl.Source))
+				break
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+
+	return ValidationError(nil, "missing required vars:\n  %s", strings.Join(missing, "\n  "))
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheckVarName(t *testing.T) {
+	for _, name := range []string{"MORIO_TICK", "nginx.log-paths", "_PRIVATE", "1X"} {
+		if err := checkVarName(name); err != nil {
+			t.Errorf("%q should be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../global-vars.yml", "a/b", `a\b`, ".hidden", "-flag", "a b"} {
+		err := checkVarName(name)
+		if err == nil {
+			t.Errorf("%q should be invalid", name)
+		} else if ExitCode(err) != ExitInvalidVar {
+			t.Errorf("%q: got exit code %d, want %d", name, ExitCode(err), ExitInvalidVar)
+		}
+	}
+}
+
+// Var names are used as file names, so they should never reach outside their folder
+func TestVarNameTraversal(t *testing.T) {
+	useTestRoot(t)
+	globals := "MORIO_TICK:\n  dflt: 30s\n"
+	writeTestFile(t, "global-vars.yml", globals)
+	writeTestFile(t, "vars.journal", `{"time":"2024-01-01T00:00:00Z","user":"test","name":"../global-vars.yml","old":null,"new":"x"}`+"\n")
+	name := "../global-vars.yml"
+
+	forceUnlock = true
+	defer func() { forceUnlock = false }()
+	checks := map[string]func() error{
+		"rm":     func() error { return RmVar(name) },
+		"revert": func() error { return RevertVar(name, "") },
+		"lock":   func() error { return LockVar(name, "x") },
+		"unlock": func() error { return UnlockVar(name) },
+		"locks":  func() error { return CheckVarLocks([]string{name}) },
+		"set":    func() error { return ValidateAndSetVars(map[string]string{name: "x"}, false) },
+	}
+	for check, run := range checks {
+		if err := run(); ExitCode(err) != ExitInvalidVar {
+			t.Errorf("%s: got %v, want an invalid var error", check, err)
+		}
+	}
+	if IsLockedVar(name) {
+		t.Errorf("a var with an invalid name cannot be locked")
+	}
+	if got := readTestFile(t, "global-vars.yml"); got != globals {
+		t.Errorf("global-vars.yml was changed to %q", got)
+	}
+	if _, err := os.Stat(GetConfigPath("locked.vars.d")); err == nil {
+		t.Errorf("locking an invalid name should not create anything")
+	}
+}
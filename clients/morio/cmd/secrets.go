@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Secret vars are stored sealed with a key that is local to the client
+// They are only revealed when templating out the configuration.
+const secretPrefix string = "morio-secret:v1:"
+
+// What we show instead of the value of a secret var
+const RedactedValue string = "***"
+
+// Location of the key used to seal secret vars
+func SecretKeyFile() string {
+	return GetConfigPath("secret.key")
+}
+
+// Checks whether a (stored) value is a sealed secret
+func IsSecretValue(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// Checks whether a var is declared as a secret
+func IsSecretVar(name string, declarations map[string][]VarDeclaration) bool {
+	for _, decl := range declarations[name] {
+		if decl.Type == "secret" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the value as it can be shown to the user
+func DisplayValue(value string) string {
+	if IsSecretValue(value) {
+		return RedactedValue
+	}
+
+	return value
+}
+
+// Loads the secret key, and creates it if it does not exist yet
+func loadSecretKey(create bool) ([]byte, error) {
+	key, err := os.ReadFile(SecretKeyFile())
+	if err == nil {
+		if len(key) != 32 {
+			return nil, ConfigError(nil, "secret key at %s is not a 256-bit key", SecretKeyFile())
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) || !create {
+		return nil, ConfigError(err, "unable to read secret key")
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, GenericError(err, "unable to generate secret key")
+	}
+	if err := WriteFileAtomic(SecretKeyFile(), key, 0600); err != nil {
+		return nil, GenericError(err, "unable to write secret key")
+	}
+
+	return key, nil
+}
+
+func secretCipher(create bool) (cipher.AEAD, error) {
+	key, err := loadSecretKey(create)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, GenericError(err, "unable to load secret key")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Seals a value so it can be stored at rest
+// Empty values and values that are already sealed are returned as-is.
+func SealSecret(value string) (string, error) {
+	if value == "" || IsSecretValue(value) {
+		return value, nil
+	}
+	gcm, err := secretCipher(true)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", GenericError(err, "unable to generate nonce")
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Reveals a sealed value
+// Values that are not sealed are returned as-is.
+func RevealSecret(value string) (string, error) {
+	if !IsSecretValue(value) {
+		return value, nil
+	}
+	gcm, err := secretCipher(false)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", ConfigError(err, "secret value is corrupt")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ConfigError(err, "unable to reveal secret (was it sealed with a different key?)")
+	}
+
+	return string(plain), nil
+}
+
+// Reveals all sealed values in a var context
+func RevealSecrets(vars map[string]string) error {
+	for key, value := range vars {
+		plain, err := RevealSecret(value)
+		if err != nil {
+			return ConfigError(err, "unable to reveal var %s", key)
+		}
+		vars[key] = plain
+	}
+
+	return nil
+}
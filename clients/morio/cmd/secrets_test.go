@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSealAndRevealSecret(t *testing.T) {
+	useTestRoot(t)
+	plain := `hunter2&<x>"`
+	sealed, err := SealSecret(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSecretValue(sealed) || sealed == plain {
+		t.Fatalf("got %q, want a sealed value", sealed)
+	}
+	if again, _ := SealSecret(sealed); again != sealed {
+		t.Errorf("sealing a sealed value should leave it as it is")
+	}
+	if _, err := os.Stat(SecretKeyFile()); err != nil {
+		t.Errorf("sealing should create the key: %v", err)
+	}
+
+	revealed, err := RevealSecret(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revealed != plain {
+		t.Errorf("got %q, want %q", revealed, plain)
+	}
+
+	vars := map[string]string{"PASSWORD": sealed, "NAME": "plain"}
+	if err := RevealSecrets(vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars["PASSWORD"] != plain || vars["NAME"] != "plain" {
+		t.Errorf("got %v, want only the secret revealed", vars)
+	}
+
+	// A different key cannot reveal the secret
+	if err := os.Remove(SecretKeyFile()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SealSecret("other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RevealSecret(sealed); err == nil {
+		t.Errorf("revealing with a different key should fail")
+	}
+}
+
+// A var that was set with --secret stays sealed when it is set again without it
+func TestSetVarKeepsSecretSealed(t *testing.T) {
+	useTestRoot(t)
+	writeTestFile(t, "global-vars.yml", "MORIO_TICK:\n  dflt: 30s\n")
+	if err := ValidateAndSetVars(map[string]string{"MORIO_PASSWORD": "first"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateAndSetVars(map[string]string{"MORIO_PASSWORD": "second"}, false); err != nil {
+		t.Fatal(err)
+	}
+	stored := getCustomVar("MORIO_PASSWORD")
+	if stored == nil || !IsSecretValue(*stored) {
+		t.Fatalf("got %v, want a sealed value", stored)
+	}
+	if revealed, err := RevealSecret(*stored); err != nil || revealed != "second" {
+		t.Errorf("got %q (%v), want the new value", revealed, err)
+	}
+}
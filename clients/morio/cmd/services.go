@@ -18,24 +18,13 @@ var startCmd = &cobra.Command{
 
   Start a specific agent:
     morio start logs`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			ChangeAgentState("audit", "start")
-			ChangeAgentState("logs", "start")
-			ChangeAgentState("metrics", "start")
-			ShowStatus()
-		} else if args[0] == "audit" {
-			ChangeAgentState("audit", "start")
-			ShowStatus()
-		} else if args[0] == "logs" {
-			ChangeAgentState("logs", "start")
-			ShowStatus()
-		} else if args[0] == "metrics" {
-			ChangeAgentState("metrics", "start")
-			ShowStatus()
-		} else {
-			_ = cmd.Help()
+			return ChangeAgentsState([]string{"audit", "logs", "metrics"}, "start")
+		} else if args[0] == "audit" || args[0] == "logs" || args[0] == "metrics" {
+			return ChangeAgentsState([]string{args[0]}, "start")
 		}
+		return cmd.Help()
 	},
 }
 
@@ -49,24 +38,13 @@ var stopCmd = &cobra.Command{
 
   Stop a specific agent:
     morio stop logs`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			ChangeAgentState("audit", "stop")
-			ChangeAgentState("logs", "stop")
-			ChangeAgentState("metrics", "stop")
-			ShowStatus()
-		} else if args[0] == "audit" {
-			ChangeAgentState("audit", "stop")
-			ShowStatus()
-		} else if args[0] == "logs" {
-			ChangeAgentState("logs", "stop")
-			ShowStatus()
-		} else if args[0] == "metrics" {
-			ChangeAgentState("metrics", "stop")
-			ShowStatus()
-		} else {
-			_ = cmd.Help()
+			return ChangeAgentsState([]string{"audit", "logs", "metrics"}, "stop")
+		} else if args[0] == "audit" || args[0] == "logs" || args[0] == "metrics" {
+			return ChangeAgentsState([]string{args[0]}, "stop")
 		}
+		return cmd.Help()
 	},
 }
 
@@ -80,24 +58,13 @@ var restartCmd = &cobra.Command{
 
   Restart a specific agent:
     morio restart logs`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			ChangeAgentState("audit", "restart")
-			ChangeAgentState("logs", "restart")
-			ChangeAgentState("metrics", "restart")
-			ShowStatus()
-		} else if args[0] == "audit" {
-			ChangeAgentState("audit", "restart")
-			ShowStatus()
-		} else if args[0] == "logs" {
-			ChangeAgentState("logs", "restart")
-			ShowStatus()
-		} else if args[0] == "metrics" {
-			ChangeAgentState("metrics", "restart")
-			ShowStatus()
-		} else {
-			_ = cmd.Help()
+			return ChangeAgentsState([]string{"audit", "logs", "metrics"}, "restart")
+		} else if args[0] == "audit" || args[0] == "logs" || args[0] == "metrics" {
+			return ChangeAgentsState([]string{args[0]}, "restart")
 		}
+		return cmd.Help()
 	},
 }
 
@@ -111,18 +78,17 @@ var statusCmd = &cobra.Command{
 
   Show the status of a specific agent:
     morio status logs`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			ShowStatus()
+			return ShowStatus()
 		} else if args[0] == "audit" {
-			PrintAgentStatus("audit")
+			return PrintAgentStatus("audit")
 		} else if args[0] == "metrics" {
-			PrintAgentStatus("metrics")
+			return PrintAgentStatus("metrics")
 		} else if args[0] == "logs" {
-			PrintAgentStatus("logs")
-		} else {
-			ShowStatus()
+			return PrintAgentStatus("logs")
 		}
+		return ShowStatus()
 	},
 }
 
@@ -132,9 +98,8 @@ var startAuditCmd = &cobra.Command{
 	Short:   "Starts the audit agent (auditbeat)",
 	Long:    "This starts the auditbeat service",
 	Example: "  morio start audit",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("audit", "start")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"audit"}, "start")
 	},
 }
 
@@ -144,9 +109,8 @@ var startLogsCmd = &cobra.Command{
 	Short:   "Starts the logs agent (filebeat)",
 	Long:    "This starts the filebeat service",
 	Example: "  morio start logs",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("logs", "start")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"logs"}, "start")
 	},
 }
 
@@ -156,9 +120,8 @@ var startMetricsCmd = &cobra.Command{
 	Short:   "Starts the metrics agent (metricbeat)",
 	Long:    "This starts the metricbeat service",
 	Example: "  morio start metrics",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("metrics", "start")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"metrics"}, "start")
 	},
 }
 
@@ -168,9 +131,8 @@ var stopAuditCmd = &cobra.Command{
 	Short:   "Stops the audit agent (auditbeat)",
 	Long:    "This stops the auditbeat service",
 	Example: "  morio stop audit",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("audit", "stop")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"audit"}, "stop")
 	},
 }
 
@@ -180,9 +142,8 @@ var stopLogsCmd = &cobra.Command{
 	Short:   "Stops the logs agent (filebeat)",
 	Long:    "This stops the filebeat service",
 	Example: "  morio stop logs",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("logs", "stop")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"logs"}, "stop")
 	},
 }
 
@@ -192,9 +153,8 @@ var stopMetricsCmd = &cobra.Command{
 	Short:   "Stops the metrics agent (metricbeat)",
 	Long:    "This stops the metricbeat service",
 	Example: "  morio stop metrics",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("metrics", "stop")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"metrics"}, "stop")
 	},
 }
 
@@ -204,9 +164,8 @@ var restartAuditCmd = &cobra.Command{
 	Short:   "Restarts the audit agent (auditbeat)",
 	Long:    "This restarts the auditbeat service",
 	Example: "  morio restart audit",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("audit", "restart")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"audit"}, "restart")
 	},
 }
 
@@ -216,9 +175,8 @@ var restartLogsCmd = &cobra.Command{
 	Short:   "Restarts the logs agent (filebeat)",
 	Long:    "This restarts the filebeat service",
 	Example: "  morio restart logs",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("logs", "restart")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"logs"}, "restart")
 	},
 }
 
@@ -228,9 +186,8 @@ var restartMetricsCmd = &cobra.Command{
 	Short:   "Restarts the metrics agent (metricbeat)",
 	Long:    "This restarts the metricbeat service",
 	Example: "  morio restart metrics",
-	Run: func(cmd *cobra.Command, args []string) {
-		ChangeAgentState("metrics", "restart")
-		ShowStatus()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ChangeAgentsState([]string{"metrics"}, "restart")
 	},
 }
 
@@ -336,20 +293,44 @@ func IsAgentRunning(agent string) (bool, error) {
 	return false, nil
 }
 
-func PrintAgentStatus(agent string) {
+// Changes the state of one or more agents, and then shows the status
+// All agents are handled, even if changing the state of one fails.
+func ChangeAgentsState(agents []string, action string) error {
+	var failed error
+	for _, agent := range agents {
+		if err := ChangeAgentState(agent, action); err != nil && failed == nil {
+			failed = AgentError(err, "failed to %s the %s agent", action, agent)
+		}
+	}
+	if err := ShowStatus(); err != nil {
+		return err
+	}
+
+	return failed
+}
+
+func PrintAgentStatus(agent string) error {
 	emoji := "!"
 	status := "stopped"
 	running, err := IsAgentRunning(agent)
-	check(err)
+	if err != nil {
+		return AgentError(err, "unable to check the status of the %s agent", agent)
+	}
 	if running {
 		emoji = " "
 		status = "running"
 	}
 	fmt.Printf("%s %s %s\n", emoji, fmt.Sprintf("%-8s", agent), fmt.Sprintf("%-14s", status))
+
+	return nil
 }
 
-func ShowStatus() {
-	PrintAgentStatus("audit")
-	PrintAgentStatus("metrics")
-	PrintAgentStatus("logs")
+func ShowStatus() error {
+	for _, agent := range []string{"audit", "metrics", "logs"} {
+		if err := PrintAgentStatus(agent); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
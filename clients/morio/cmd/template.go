@@ -2,107 +2,351 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/cbroglie/mustache"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 )
 
 // morio template
 var templateCmd = &cobra.Command{
-	Use:     "template",
-	Short:   "Template out the agents configuration",
-	Example: "  morio template",
-	Long:    `Templates out the configuration for the different agents.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// First ensure all vars are present
-		EnsureTemplateVars()
-		// Then load the vars
-		context := GetVars()
-		// Audit
-		TemplateOutConfigFile("audit/config-template.yml", "audit/config.yml", context)
-		TemplateOutInputFolder("audit/module-templates.d", "audit/modules.d", context)
-		TemplateOutConfigFolder("audit/rule-templates.d", "audit/rules.d", context)
-		// metrics
-		TemplateOutConfigFile("metrics/config-template.yml", "metrics/config.yml", context)
-		TemplateOutInputFolder("metrics/module-templates.d", "metrics/modules.d", context)
-		// logs
-		TemplateOutConfigFile("logs/config-template.yml", "logs/config.yml", context)
-		TemplateOutInputFolder("logs/module-templates.d", "logs/modules.d", context)
-		TemplateOutInputFolder("logs/input-templates.d", "logs/inputs.d", context)
+	Use:   "template",
+	Short: "Template out the agents configuration",
+	Example: `  morio template
+  morio template --diff`,
+	Long: `Templates out the configuration for the different agents.
+
+With --dry-run or --diff, the configuration is rendered in memory and
+compared to what is on disk, without changing anything. --dry-run lists
+the files that would change, --diff shows a unified diff for each agent.
+Either way, the exit code is 9 when there are changes.
+
+Before the configuration is activated, it is tested with the test config
+command of each agent's beat, as set under agents in morio.yml. If a beat
+rejects the configuration, nothing is activated.
+
+Every run records what it rendered in a manifest, which 'morio verify'
+checks the configuration against.`,
+	Annotations: mutating,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		diff, _ := cmd.Flags().GetBool("diff")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		preview := diff || dryRun
+		context, secrets, err := TemplateContext(preview)
+		if err != nil {
+			return err
+		}
+		rendered, err := RenderTargets(context)
+		if err != nil {
+			return err
+		}
+		if preview {
+			return PreviewConfigChanges(rendered, diff, secrets)
+		}
+		skipValidation, _ := cmd.Flags().GetBool("skip-validation")
+		return ApplyRenderedConfig(rendered, !skipValidation, VarsHash(context))
 	},
 }
 
-func init() {
-	RootCmd.AddCommand(templateCmd)
+// morio template rollback
+var templateRollbackCmd = &cobra.Command{
+	Use:   "rollback [agent]...",
+	Short: "Restore the previous configuration of the agents",
+	Example: `  morio template rollback
+  morio template rollback logs`,
+	Long: `Restores the configuration as it was before the last 'morio template'.
+
+The configuration that is replaced becomes the previous configuration,
+so running this twice undoes the rollback. Without arguments, all agents
+are rolled back.`,
+	Annotations: mutating,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return RollbackConfig(args)
+	},
+}
+
+// Loads the vars to render the templates with
+// This also returns the revealed secrets, so they can be redacted from output.
+// In a dry run, nothing is written to disk, so the default vars are
+// resolved in memory instead.
+func TemplateContext(dryRun bool) (map[string]interface{}, []string, error) {
+	// First ensure all vars are present
+	defaults, err := TemplateDefaultVars()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dryRun {
+		for key, val := range defaults {
+			if err := SetDefaultVar(key, val); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	// And that default vars that are no longer declared are removed
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dryRun {
+		if err := PruneVars(declarations, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Then load the vars, and make sure they match their declarations
+	context, sources, err := GetVarsWithSources()
+	if err != nil {
+		return nil, nil, err
+	}
+	if dryRun {
+		orphaned, _, err := FindOrphanedVars(declarations)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, key := range orphaned {
+			if sources[key] == VarSourceDefault {
+				delete(context, key)
+			}
+		}
+		for key, val := range defaults {
+			if source, found := sources[key]; !found || source == VarSourceDefault {
+				context[key] = val
+			}
+		}
+	}
+	if err := CheckRequiredVars(context, declarations); err != nil {
+		return nil, nil, err
+	}
+	if err := ValidateVars(context, declarations); err != nil {
+		return nil, nil, err
+	}
+	// Secrets are only revealed to render the templates
+	var sealed []string
+	for key, value := range context {
+		if IsSecretValue(value) {
+			sealed = append(sealed, key)
+		}
+	}
+	if err := RevealSecrets(context); err != nil {
+		return nil, nil, err
+	}
+	var secrets []string
+	for _, key := range sealed {
+		if context[key] != "" {
+			secrets = append(secrets, context[key])
+		}
+	}
+	// Host facts are gathered at template time
+	AddHostFacts(context)
+	typed := TypedContext(context, declarations)
+	for _, key := range sealed {
+		if value, ok := typed[key].(string); ok {
+			typed[key] = secretValue(value)
+		}
+	}
+
+	return typed, secrets, nil
+}
+
+// A template (or folder of templates) and where it gets rendered to
+type renderTarget struct {
+	Agent  string
+	From   string
+	To     string
+	Folder bool
+	// Input templates are parsed as YAML to strip the moriodata
+	// and add the default processors
+	Input bool
+}
+
+// Everything that 'morio template' renders, in order
+var renderTargets = []renderTarget{
+	// Audit
+	{Agent: "audit", From: "audit/config-template.yml", To: "audit/config.yml"},
+	{Agent: "audit", From: "audit/module-templates.d", To: "audit/modules.d", Folder: true, Input: true},
+	{Agent: "audit", From: "audit/rule-templates.d", To: "audit/rules.d", Folder: true},
+	// metrics
+	{Agent: "metrics", From: "metrics/config-template.yml", To: "metrics/config.yml"},
+	{Agent: "metrics", From: "metrics/module-templates.d", To: "metrics/modules.d", Folder: true, Input: true},
+	// logs
+	{Agent: "logs", From: "logs/config-template.yml", To: "logs/config.yml"},
+	{Agent: "logs", From: "logs/module-templates.d", To: "logs/modules.d", Folder: true, Input: true},
+	{Agent: "logs", From: "logs/input-templates.d", To: "logs/inputs.d", Folder: true, Input: true},
+}
+
+// A config file that was rendered in memory, but not yet written to disk
+type renderedFile struct {
+	From    string
+	To      string
+	Content string
+	// The partials that the template uses
+	Partials []string
+	// Whether the content holds a revealed secret
+	Secret bool
+}
+
+// A render target along with its rendered files
+type renderedTarget struct {
+	renderTarget
+	Files []renderedFile
+}
+
+// Renders all targets in memory
+// Nothing is written, so a template that fails to render leaves the
+// configuration on disk untouched.
+func RenderTargets(context map[string]interface{}) ([]renderedTarget, error) {
+	rendered := make([]renderedTarget, 0, len(renderTargets))
+	undefined := &UndefinedVarsError{}
+	for _, target := range renderTargets {
+		files, err := target.Render(context)
+		if undefined.collect(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, renderedTarget{renderTarget: target, Files: files})
+	}
+	if len(undefined.Vars) > 0 {
+		return nil, TemplateError(nil, "templates use undefined vars:%s", undefined)
+	}
+
+	return rendered, nil
+}
+
+// Renders the templates of the target in memory
+func (target renderTarget) Render(context map[string]interface{}) ([]renderedFile, error) {
+	files, err := target.Files()
+	if err != nil {
+		return nil, err
+	}
+	rendered := make([]renderedFile, 0, len(files))
+	undefined := &UndefinedVarsError{}
+	for _, file := range files {
+		// Templates whose moriodata.when conditions do not hold are skipped
+		if target.Input {
+			condition, err := TemplateUnmetCondition(file.From)
+			if err != nil {
+				return nil, err
+			}
+			if condition != "" {
+				fmt.Fprintf(os.Stderr, "Skipping %s, condition %s is false\n", GetConfigPath(file.From), condition)
+				continue
+			}
+		}
+		var output string
+		if target.Input {
+			output, err = RenderInputFile(file.From, context)
+		} else {
+			output, err = RenderConfigFile(file.From, context)
+		}
+		if undefined.collect(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		partials, err := TemplateFilePartials(file.From)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, renderedFile{From: file.From, To: file.To, Content: output, Partials: partials, Secret: containsSecret(output, context)})
+	}
+	if len(undefined.Vars) > 0 {
+		return nil, undefined
+	}
+
+	return rendered, nil
 }
 
-func EnsureTemplateVars() {
-	EnsureGlobalVars()
-	EnsureTemplateFolderVars("audit/module-templates.d")
-	EnsureTemplateFolderVars("metrics/module-templates.d")
-	EnsureTemplateFolderVars("logs/module-templates.d")
-	EnsureTemplateFolderVars("logs/input-templates.d")
+// A single template file and the file it renders to
+type renderFile struct {
+	From string
+	To   string
 }
 
-// FIXME: make this platform agnostic
-func EnsureTemplateFolderVars(folder string) {
-	for _, file := range TemplateList(folder) {
-		EnsureTemplateFileVars(folder + "/" + file)
+// Lists the template files of the target, along with the file they render to
+func (target renderTarget) Files() ([]renderFile, error) {
+	if !target.Folder {
+		return []renderFile{{From: target.From, To: target.To}}, nil
+	}
+	templates, err := TemplateList(target.From)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]renderFile, 0, len(templates))
+	for _, file := range templates {
+		files = append(files, renderFile{From: target.From + "/" + file, To: target.To + "/" + file})
 	}
+
+	return files, nil
 }
 
-func EnsureTemplateFileVars(file string) {
-	// Load defaults from template file
-	defaults := ExtractTemplateDefaultVars(file)
-	// Iterate over them an write them to disk
-	for key, val := range defaults {
-		SetDefaultVar(key, val)
+func init() {
+	RootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateRollbackCmd)
+	templateCmd.Flags().Bool("dry-run", false, "list the config files that would change, without changing them")
+	templateCmd.Flags().Bool("diff", false, "show a diff of the config that would change, without changing it")
+	templateCmd.Flags().Bool("skip-validation", false, "do not test the configuration with the beats before activating it")
+	templateCmd.Flags().Bool("strict", false, "fail on templates that use undefined vars (or set strict in morio.yml)")
+	viper.BindPFlag("strict", templateCmd.Flags().Lookup("strict"))
+}
+
+// Collects the default values of all declared vars
+// Defaults in templates take precedence over those in the global vars.
+func TemplateDefaultVars() (map[string]string, error) {
+	vars, err := ReadGlobalVars()
+	if err != nil {
+		return nil, err
+	}
+	defaults := ExtractDefaultsFromVars(vars)
+	for _, folder := range moduleTemplateFolders {
+		templates, err := TemplateList(folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range templates {
+			found, err := ExtractTemplateDefaultVars(folder + "/" + file)
+			if err != nil {
+				return nil, err
+			}
+			for key, val := range found {
+				defaults[key] = val
+			}
+		}
 	}
+
+	return defaults, nil
 }
 
-func TemplateOutConfigFile(from string, to string, context map[string]string) {
+// Renders a config template
+func RenderConfigFile(from string, context map[string]interface{}) (string, error) {
 	// Read the template from disk
 	template, err := os.ReadFile(GetConfigPath(from))
 	if err != nil {
-		fmt.Printf("Failed to read config file: %v\n", err)
-		panic(err)
+		return "", ConfigError(err, "failed to read config template")
 	}
 
 	// Inject run-time vars
 	context["MORIO_TEMPLATE_SOURCE_FILE"] = GetConfigPath(from)
 
 	// Render with mustache
-	output, err := mustache.Render("{{={| |}=}}"+string(template), context)
-
-	// Open file
-	file, err := os.Create(GetConfigPath(to))
-	check(err)
-	defer file.Close()
-
-	// Write value
-	_, err = file.WriteString(output)
+	output, err := RenderTemplate(string(template), from, context, StrictRendering())
 	if err != nil {
-		fmt.Println("Failed to write to " + GetConfigPath(to))
-		panic(err)
-	} else {
-		fmt.Println(GetConfigPath(to))
+		return "", TemplateError(err, "failed to render %s", GetConfigPath(from))
 	}
 
-	// Sync
-	file.Sync()
+	return output, nil
 }
 
-func TemplateOutInputFile(from string, to string, context map[string]string) {
+// Renders an input (or module) template
+// The moriodata is stripped, and the default processors are added.
+func RenderInputFile(from string, context map[string]interface{}) (string, error) {
 	// Read the template from disk
 	template, err := os.ReadFile(GetConfigPath(from))
 	if err != nil {
-		fmt.Printf("Failed to read template file: %v\n", err)
-		panic(err)
+		return "", ConfigError(err, "failed to read template file")
 	}
 
 	// Inject run-time vars
@@ -110,88 +354,60 @@ func TemplateOutInputFile(from string, to string, context map[string]string) {
 	context["MORIO_MODULE_NAME"] = ModuleNameFromFile(from)
 
 	// Render with mustache
-	templated, err := mustache.Render("{{={| |}=}}"+string(template), context)
+	templated, err := RenderTemplate(string(template), from, context, StrictRendering())
+	if err != nil {
+		return "", TemplateError(err, "failed to render %s", GetConfigPath(from))
+	}
 
 	// Convert back to Yaml
 	var result []map[string]interface{}
-	yaml.Unmarshal([]byte(templated), &result)
+	err = yaml.Unmarshal([]byte(templated), &result)
 	if err != nil {
-		fmt.Println("Failed to parse templated YAML data. Bailing out.")
-		panic(err)
+		return "", TemplateError(err, "failed to parse templated YAML data from %s", GetConfigPath(from))
 	}
 
-	// Filter out moriodata
-	var inputs = AddDefaultProcessorsToInputs(StripMoriodataFromInputs(result), from)
-
-	// Add default processors
-	//fmt.Printf("Inputs: %v", inputs)
-
-	// Convert back to a YAML string
-	yamlData, err := yaml.Marshal(inputs)
+	// Filter out moriodata and add default and global processors
+	processors, err := TemplateProcessors(from, context)
 	if err != nil {
-		fmt.Println("Unable to parse YAML inputs from template file. Bailing out.")
-		panic(err)
+		return "", err
 	}
+	var inputs = AddDefaultProcessorsToInputs(StripMoriodataFromInputs(result), from, context)
+	inputs = AddGlobalProcessorsToInputs(inputs, processors)
 
-	// Open file
-	file, err := os.Create(GetConfigPath(to))
-	check(err)
-	defer file.Close()
-
-	// Write to disk
-	_, err = file.WriteString(string(yamlData))
+	// Convert back to a YAML string
+	yamlData, err := yaml.Marshal(inputs)
 	if err != nil {
-		fmt.Println("Failed to write to " + GetConfigPath(to))
-		panic(err)
-	} else {
-		fmt.Println(GetConfigPath(to))
+		return "", TemplateError(err, "unable to serialize YAML inputs from %s", GetConfigPath(from))
 	}
 
-	// Sync
-	file.Sync()
+	return string(yamlData), nil
 }
 
-func TemplateOutConfigFolder(from string, to string, context map[string]string) {
-	ClearFolder(to)
-	for _, file := range TemplateList(from) {
-		TemplateOutConfigFile(from+"/"+file, to+"/"+file, context)
-	}
-}
-
-func TemplateOutInputFolder(from string, to string, context map[string]string) {
-	ClearFolder(to)
-	for _, file := range TemplateList(from) {
-		TemplateOutInputFile(from+"/"+file, to+"/"+file, context)
-	}
-}
-
-func ClearFolder(folder string) {
+// Lists the files in a config folder that are managed by 'morio template'
+func RenderedFileList(folder string) ([]string, error) {
+	var files []string
 	path := GetConfigPath(folder)
-	files, err := os.ReadDir(path)
+	entries, err := os.ReadDir(path)
 	if err != nil {
-		fmt.Println("Unable to read files from folder at " + path)
-		panic(err)
+		return nil, ConfigError(err, "unable to read files from folder at %s", path)
 	}
 
-	for _, file := range files {
-		filePath := filepath.Join(path, file.Name())
+	for _, file := range entries {
 		suffix := filepath.Ext(file.Name())
 		if !file.IsDir() && (suffix == ".yml" || suffix == ".disabled" || suffix == ".rules") {
-			if err := os.Remove(filePath); err != nil {
-				fmt.Println("Failed to remove file " + filePath)
-				fmt.Print(err)
-			}
+			files = append(files, file.Name())
 		}
 	}
+
+	return files, nil
 }
 
-func TemplateList(folder string) []string {
+func TemplateList(folder string) ([]string, error) {
 	var files []string
-	path := filepath.Join([]string{"/etc", "morio", folder}...)
+	path := GetConfigPath(folder)
 	templates, err := ioutil.ReadDir(path)
 	if err != nil {
-		fmt.Println("Unable to load template list from " + path)
-		panic(err)
+		return nil, ConfigError(err, "unable to load template list from %s", path)
 	}
 
 	for _, template := range templates {
@@ -201,91 +417,35 @@ func TemplateList(folder string) []string {
 		}
 	}
 
-	return files
+	return files, nil
 }
 
-func ExtractTemplateDefaultVars(from string) map[string]string {
+// Extracts the default values of the vars declared in a template
+func ExtractTemplateDefaultVars(from string) (map[string]string, error) {
 	// Get the moriodata from the template
-	moriodata := TemplateDocsAsYaml(from)
-
-	// Prepare a map to hold our defaults
-	// Note that they will all be converted to strings
-	defaults := make(map[string]string)
+	moriodata, err := TemplateDocsAsYaml(from)
+	if err != nil {
+		return nil, err
+	}
 
 	// Access the nested map at "moriodata.vars"
 	vars, hasVars := moriodata["vars"].(map[string]interface{})
 	if !hasVars {
-		return defaults
-	}
-
-	// Iterate over the vars map
-	for key, value := range vars {
-		// Type assert value to map[string]interface{}
-		if varMap, ok := value.(map[string]interface{}); ok {
-			// Extract the "dflt" value if it exists
-			// and then convert it to string, depending on its type
-			if dflt, exists := varMap["dflt"]; exists {
-				switch v := dflt.(type) {
-				case string:
-					defaults[key] = v
-				case bool:
-					defaults[key] = strconv.FormatBool(v)
-				case int:
-					defaults[key] = strconv.Itoa(v)
-				case float64:
-					defaults[key] = strconv.FormatFloat(v, 'f', -1, 64)
-				case []interface{}:
-					// Handle arrays
-					var elements []string
-					for _, item := range v {
-						// Convert each element to a string
-						elements = append(elements, fmt.Sprintf("%q", item))
-					}
-					// Join elements with commas
-					defaults[key] = "[ " + strings.Join(elements, ",") + " ]"
-				default:
-					defaults[key] = fmt.Sprintf("%v", v)
-				}
-			}
-		}
+		return make(map[string]string), nil
 	}
 
-	return defaults
+	return ExtractDefaultsFromVars(vars), nil
 }
 
+// Extracts the default values from var declarations
+// They are formatted the same way as values set with 'morio vars set',
+// so lists and maps are stored as JSON.
 func ExtractDefaultsFromVars(vars map[string]interface{}) map[string]string {
-	// Prepare a map to hold our defaults
-	// Note that they will all be converted to strings
 	defaults := make(map[string]string)
-
-	// Iterate over the vars map
 	for key, value := range vars {
-		// Type assert value to map[string]interface{}
 		if varMap, ok := value.(map[string]interface{}); ok {
-			// Extract the "dflt" value if it exists
-			// and then convert it to string, depending on its type
 			if dflt, exists := varMap["dflt"]; exists {
-				switch v := dflt.(type) {
-				case string:
-					defaults[key] = v
-				case bool:
-					defaults[key] = strconv.FormatBool(v)
-				case int:
-					defaults[key] = strconv.Itoa(v)
-				case float64:
-					defaults[key] = strconv.FormatFloat(v, 'f', -1, 64)
-				case []interface{}:
-					// Handle arrays
-					var elements []string
-					for _, item := range v {
-						// Convert each element to a string
-						elements = append(elements, fmt.Sprintf("%v", item))
-					}
-					// Join elements with commas
-					defaults[key] = "[ " + strings.Join(elements, ",") + " ]"
-				default:
-					defaults[key] = fmt.Sprintf("%v", v)
-				}
+				defaults[key] = FormatVarValue(dflt)
 			}
 		}
 	}
@@ -299,38 +459,42 @@ func isString(val interface{}) bool {
 }
 
 // FIXME: Make this platform agnostic
-func TemplateDocsAsYaml(path string) map[string]interface{} {
+func TemplateDocsAsYaml(path string) (map[string]interface{}, error) {
 	template, err := os.ReadFile(GetConfigPath(path))
 	if err != nil {
-		fmt.Println("Cannot read template file. Bailing out.")
-		panic(err)
+		return nil, ConfigError(err, "cannot read template file")
 	}
 
-	// Render with mustache because the tags make for invalid YAML
+	// Render first because the tags make for invalid YAML
 	// and we are only interested in extracting the moriodata
-	context := GetVars()
-	cleanTemplate, err := mustache.Render("{{={| |}=}}"+string(template), context)
+	// Host facts are left out, the moriodata does not depend on them
+	vars, err := GetVars()
+	if err != nil {
+		return nil, err
+	}
+	cleanTemplate, err := RenderTemplate(moriodataSource(string(template)), path, TypedContext(vars, nil), false)
+	if err != nil {
+		return nil, TemplateError(err, "failed to render %s", GetConfigPath(path))
+	}
 
 	// Now parse the cleaned template as YAML
 	var result []map[string]interface{}
-	yaml.Unmarshal([]byte(cleanTemplate), &result)
+	err = yaml.Unmarshal([]byte(cleanTemplate), &result)
 	if err != nil {
-		fmt.Println("Failed to parse YAML data in template. Bailing out.")
-		panic(err)
+		return nil, TemplateError(err, "failed to parse YAML data in %s", GetConfigPath(path))
 	}
 
 	// Find and return the moriodata value
 	for _, item := range result {
 		if moriodata, hasMoriodata := item["moriodata"]; hasMoriodata {
 			if moriodataMap, ok := moriodata.(map[string]interface{}); ok {
-				return moriodataMap
+				return moriodataMap, nil
 			}
-			fmt.Println("Moriodata value is not a map. Bailing out.")
-			panic("Invalid moriodata structure")
+			return nil, TemplateError(nil, "moriodata value in %s is not a map", GetConfigPath(path))
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 func StripMoriodataFromInputs(inputs []map[string]interface{}) []map[string]interface{} {
@@ -344,15 +508,16 @@ func StripMoriodataFromInputs(inputs []map[string]interface{}) []map[string]inte
 	return filteredInputs
 }
 
-func AddDefaultProcessorsToInputs(inputs []map[string]interface{}, from string) []map[string]interface{} {
+func AddDefaultProcessorsToInputs(inputs []map[string]interface{}, from string, context map[string]interface{}) []map[string]interface{} {
 	// These are processors that we add to every input
 	// This way, we keep the boilerplate to a minimum
+	clientUUID, _ := context["MORIO_CLIENT_UUID"].(string)
 	defaultProcessors := []map[string]interface{}{
 		{
 			"add_fields": map[string]interface{}{
 				"target": "host",
 				"fields": map[string]interface{}{
-					"id": GetVar("MORIO_CLIENT_UUID"),
+					"id": clientUUID,
 				},
 			},
 		},
@@ -404,31 +569,24 @@ func AddDefaultProcessorsToInputs(inputs []map[string]interface{}, from string)
 	return inputs
 }
 
-// FIXME: Make this platform agnostic
-func EnsureGlobalVars() map[string]string {
+// Reads the global vars declarations from disk
+func ReadGlobalVars() (map[string]interface{}, error) {
 	// Read the file from disk
-	data, err := os.ReadFile("/etc/morio/global-vars.yml")
+	data, err := os.ReadFile(GetConfigPath("global-vars.yml"))
 	if err != nil {
-		fmt.Println("Cannot read global variables file. Bailing out.")
-		panic(err)
+		return nil, ConfigError(err, "cannot read global variables file")
 	}
 
 	// Parse as YAML into vars
 	var vars map[string]interface{}
-	yaml.Unmarshal([]byte(data), &vars)
-
-	// Parse for default values and store then as strings
-	defaults := ExtractDefaultsFromVars(vars)
-
-	// Iterate over them an write them to disk
-	for key, val := range defaults {
-		SetDefaultVar(key, val)
+	if err := yaml.Unmarshal([]byte(data), &vars); err != nil {
+		return nil, ConfigError(err, "cannot parse global variables file")
 	}
 
-	return defaults
+	return vars, nil
 }
 
-// FIXME: Make this platform agnostic
+// Resolves a path relative to the installation root
 func GetConfigPath(parts ...string) string {
-	return filepath.Join(append([]string{"/etc", "morio"}, parts...)...)
+	return filepath.Join(append([]string{GetConfigRoot()}, parts...)...)
 }
@@ -0,0 +1,7 @@
+//go:build !windows && !linux
+
+package cmd
+
+import "golang.org/x/sys/unix"
+
+const ioctlReadTermios = unix.TIOCGETA
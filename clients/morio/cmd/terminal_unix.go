@@ -0,0 +1,15 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+// Checks whether stdin is a terminal, so we can prompt the user
+func stdinIsTerminal() bool {
+	_, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), ioctlReadTermios)
+
+	return err == nil
+}
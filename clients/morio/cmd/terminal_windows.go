@@ -0,0 +1,15 @@
+//go:build windows
+
+package cmd
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// Checks whether stdin is a terminal, so we can prompt the user
+func stdinIsTerminal() bool {
+	var mode uint32
+
+	return windows.GetConsoleMode(windows.Handle(os.Stdin.Fd()), &mode) == nil
+}
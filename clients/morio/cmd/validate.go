@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The beat that runs each agent
+var agentBeats = map[string]string{
+	"audit":   "auditbeat",
+	"logs":    "filebeat",
+	"metrics": "metricbeat",
+}
+
+// Has the beats test the staged configuration
+// An agent whose beat is not configured (or not installed) is skipped with a
+// warning, so that templating still works before the agents are installed.
+func ValidateStagedConfig(rendered []renderedTarget) error {
+	var agents []string
+	files := make(map[string][]renderedFile)
+	for _, target := range rendered {
+		if _, seen := files[target.Agent]; !seen {
+			agents = append(agents, target.Agent)
+		}
+		files[target.Agent] = append(files[target.Agent], target.Files...)
+	}
+
+	for _, agent := range agents {
+		if err := validateAgentConfig(agent, files[agent]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Runs '<beat> test config' against the staged configuration of an agent
+func validateAgentConfig(agent string, files []renderedFile) error {
+	beat := agentBeats[agent]
+	path := viper.GetString("agents." + agent)
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "Warning: agents.%s is not set in morio.yml, not validating the %s configuration\n", agent, agent)
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s not found at %s, not validating the %s configuration\n", beat, path, agent)
+		return nil
+	}
+
+	staged := filepath.Join(StagedConfigFolder(), agent)
+	test := exec.Command(path, "test", "config", "-c", filepath.Join(staged, "config.yml"), "--path.config", staged)
+	output, err := test.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	return TemplateError(nil, "%s rejected the %s configuration, so nothing was activated:\n%s", beat, agent, strings.TrimSpace(mapStagedPaths(string(output), files)))
+}
+
+// Replaces the paths to staged files with the template they were rendered from
+func mapStagedPaths(output string, files []renderedFile) string {
+	for _, file := range files {
+		staged := filepath.Join(StagedConfigFolder(), file.To)
+		output = strings.ReplaceAll(output, staged, GetConfigPath(file.To)+" (rendered from "+GetConfigPath(file.From)+")")
+	}
+
+	return output
+}
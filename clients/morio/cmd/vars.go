@@ -2,14 +2,15 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
+	"io/fs"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
 	"sort"
-	"strings"
 )
 
 // morio vars
@@ -25,7 +26,19 @@ that take various variables (vars). This command allows you to manage
 these vars.
 
 To combine the configuration templates and your vars into an actual
-configuration, run 'morio template'.`,
+configuration, run 'morio template'.
+
+Vars are looked up in the following order, the first match wins:
+  1. Locked vars, as set with 'morio vars lock'
+  2. MORIO_VAR_<NAME> environment variables
+  3. Runtime vars in /run/morio/vars.d (or $MORIO_RUNTIME/vars.d)
+  4. The vars file passed with --vars-file
+  5. Custom vars, as set with 'morio vars set'
+  6. The active profile (see 'morio profile')
+  7. Default vars, from the templates and global vars
+
+Locked vars are set by policy. Commands that change vars will refuse
+to change a locked var, unless you pass --force-unlock.`,
 }
 
 // morio vars clear
@@ -34,10 +47,14 @@ var clearCmd = &cobra.Command{
 	Short: "Set a var to an empty string",
 	Long: `Stores an empty string as a new value for a template variable,
 This will always write a custom template variable.`,
-	Example: "  morio vars clear WARP_DRIVE",
-	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		SetVar(args[0], "false")
+	Example:     "  morio vars clear WARP_DRIVE",
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[0]); err != nil {
+			return err
+		}
+		return ValidateAndSetVars(map[string]string{args[0]: ""}, false)
 	},
 }
 
@@ -47,10 +64,14 @@ var disableCmd = &cobra.Command{
 	Short: "Set a var to false",
 	Long: `Stores 'false' as a new value for a template variable,
 This will always write a custom template variable.`,
-	Example: "  morio vars disable WARP_DRIVE",
-	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		SetVar(args[0], "false")
+	Example:     "  morio vars disable WARP_DRIVE",
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[0]); err != nil {
+			return err
+		}
+		return ValidateAndSetVars(map[string]string{args[0]: "false"}, false)
 	},
 }
 
@@ -60,10 +81,44 @@ var enableCmd = &cobra.Command{
 	Short: "Set a var to true",
 	Long: `Stores 'true' as a new value for a template variable,
 This will always write a custom template variable.`,
-	Example: "  morio vars enable WARP_DRIVE",
+	Example:     "  morio vars enable WARP_DRIVE",
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[0]); err != nil {
+			return err
+		}
+		return ValidateAndSetVars(map[string]string{args[0]: "true"}, false)
+	},
+}
+
+// morio vars describe
+var describeCmd = &cobra.Command{
+	Use:   "describe NAME",
+	Short: "Describe a var",
+	Long: `Describes template variable (var) NAME.
+
+This shows the effective value of the var and where it comes from:
+  - locked: locked by policy with 'morio vars lock'
+  - env: set with a MORIO_VAR_<NAME> environment variable
+  - runtime: set in the runtime vars folder (/run/morio/vars.d)
+  - vars file: set in the file passed with --vars-file
+  - custom: set with 'morio vars set' (or similar)
+  - profile: set in the active profile
+  - host fact: gathered from the host (the MORIO_HOST_* vars)
+  - template default: the dflt value of a module template
+  - global default: the dflt value in the global vars
+  - default: set by the Morio client itself (eg: by 'morio init')
+
+It also shows which templates declare the var, and which rendered
+configuration files use it.`,
+	Example: "  morio vars describe WARP_DRIVE",
 	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		SetVar(args[0], "true")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[0]); err != nil {
+			return err
+		}
+		return DescribeVar(args[0])
 	},
 }
 
@@ -74,17 +129,25 @@ var exportCmd = &cobra.Command{
 	Long: `Exports all template variables and their values",
 This will always write a custom template variable.`,
 	Example: "  morio vars export",
-	Run: func(cmd *cobra.Command, args []string) {
-		stringVars := GetVars()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stringVars, err := GetVars()
+		if err != nil {
+			return err
+		}
 		typedVars := make(map[string]interface{})
 		for key, val := range stringVars {
-			typedVars[key], _ = parseYAMLValue(val)
+			if IsSecretValue(val) {
+				typedVars[key] = RedactedValue
+			} else {
+				typedVars[key], _ = parseYAMLValue(val)
+			}
 		}
 		typedVarsAsJson, err := json.MarshalIndent(typedVars, "", "  ")
 		if err != nil {
-			fmt.Println("export failed JSON")
+			return GenericError(err, "failed to export vars as JSON")
 		}
 		fmt.Print(string(typedVarsAsJson))
+		return nil
 	},
 }
 
@@ -94,55 +157,196 @@ var getCmd = &cobra.Command{
 	Short: "Get the value of a var",
 	Long: `This returns the value of template variable (var) NAME.
 If var NAME is not set, this will return an empty string.
-A custom NAME var has precedence over a default NAME var.`,
+A custom NAME var has precedence over a default NAME var.
+The value of a secret var is shown as ***.`,
 	Example: "  morio vars get WARP_DRIVE",
 	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[0]); err != nil {
+			return err
+		}
 		value := GetVar(args[0])
-		fmt.Print(string(value))
+		fmt.Print(DisplayValue(value))
+		return nil
+	},
+}
+
+// morio vars history
+var historyCmd = &cobra.Command{
+	Use:   "history [NAME]",
+	Short: "Show the history of var changes",
+	Long: `Shows the journal of changes to (custom) template variables.
+Every change is listed with the time, the user who made it,
+and the value before and after the change.
+
+If you pass it NAME, this only shows the changes to that var.`,
+	Example: `  morio vars history
+  morio vars history WARP_DRIVE`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := ""
+		if len(args) > 0 {
+			if err := checkVarName(args[0]); err != nil {
+				return err
+			}
+			name = args[0]
+		}
+		return ShowVarHistory(name)
 	},
 }
 
 // morio vars import
 var importCmd = &cobra.Command{
-	Args:    cobra.ExactArgs(1),
-	Example: "  morio vars import ~/morio_vars.json",
-	Use:     "import [file_path]",
-	Short:   "Import vars from a JSON file",
-	Long: `Imports vars from a JSON file.
-Run 'morio vars export' to see the JSON structure`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// Read data from file
-		jsonData, err := os.ReadFile(args[0])
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	Example: `  morio vars import ~/morio_vars.json
+  morio vars import --dry-run ~/morio_vars.yml
+  morio vars import --replace --format dotenv ~/morio.env`,
+	Use:   "import [file_path]",
+	Short: "Import vars from a JSON, YAML, or dotenv file",
+	Long: `Imports vars from a JSON, YAML, or dotenv file.
+Run 'morio vars export' to see the JSON structure.
+
+The format is derived from the file extension (.json, .yml, .yaml,
+or .env) unless you specify it with --format.
+
+All vars in the file are set as custom vars, even when they match a
+default. Use --dry-run to see what would change without changing anything,
+and --replace to also remove custom vars that are not in the file.
+
+Secret vars that were redacted by the export are skipped.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		replace, _ := cmd.Flags().GetBool("replace")
+
+		return ImportVars(args[0], format, dryRun, replace)
+	},
+}
+
+// morio vars list
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all vars",
+	Long: `Lists all template variables and their values.
+Use --show-source to also show where each value comes from.`,
+	Example: `  morio vars list
+  morio vars list --show-source`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showSource, _ := cmd.Flags().GetBool("show-source")
+		allVars, sources, err := GetVarsWithSources()
 		if err != nil {
-			log.Fatalf("Failed to open file: %v", err)
+			return err
 		}
+		for _, key := range SortedVarNames(allVars) {
+			if showSource {
+				fmt.Printf("%s: %v (%s)\n", key, DisplayValue(allVars[key]), sources[key])
+			} else if sources[key] == VarSourceLocked {
+				fmt.Printf("%s: %v (locked)\n", key, DisplayValue(allVars[key]))
+			} else {
+				fmt.Printf("%s: %v\n", key, DisplayValue(allVars[key]))
+			}
+		}
+		return nil
+	},
+}
 
-		// Parse the JSON data
-		var data map[string]string
-		err = json.Unmarshal(jsonData, &data)
+// morio vars lock
+var lockCmd = &cobra.Command{
+	Use:   "lock NAME [value]",
+	Short: "Lock a var",
+	Long: `Locks template variable (var) NAME to a value.
+
+Locked vars take precedence over all other vars, and commands that
+change vars will refuse to change them unless you pass --force-unlock.
+This is intended for vars that are set by (central) policy.
+
+Without a value, the var is locked to its current value.`,
+	Example: `  morio vars lock MORIO_TRACK_INVENTORY true
+  morio vars lock WARP_DRIVE`,
+	Annotations: mutating,
+	Args:        cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[0]); err != nil {
+			return err
+		}
+		value := GetVar(args[0])
+		if len(args) > 1 {
+			value = args[1]
+		}
+		declarations, err := GetVarDeclarations()
 		if err != nil {
-			log.Fatalf("Failed to parse JSON: %v", err)
+			return err
 		}
-
-		// Iterate over the keys and values in the map
-		for key, value := range data {
-			SetVar(key, value)
+		if err := ValidateVars(map[string]string{args[0]: value}, declarations); err != nil {
+			return err
+		}
+		if IsSecretVar(args[0], declarations) {
+			if value, err = SealSecret(value); err != nil {
+				return err
+			}
 		}
+		return LockVar(args[0], value)
 	},
 }
 
-// morio vars list
-var listCmd = &cobra.Command{
-	Use:     "list",
-	Short:   "List all vars",
-	Long:    "Lists all template variables and their values",
-	Example: "  morio vars list",
-	Run: func(cmd *cobra.Command, args []string) {
-		allVars := GetVars()
-		for key, val := range allVars {
-			fmt.Printf("%s: %v\n", key, val)
+// morio vars unlock
+var unlockCmd = &cobra.Command{
+	Use:   "unlock NAME",
+	Short: "Unlock a var",
+	Long: `Lifts the lock on template variable (var) NAME.
+After this, the var resolves as usual, and can be changed again.`,
+	Example:     "  morio vars unlock WARP_DRIVE",
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return UnlockVar(args[0])
+	},
+}
+
+// morio vars prune
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove orphaned default vars",
+	Long: `Removes default vars that are no longer declared by the global vars
+or any enabled template, for example because a module was disabled.
+
+Custom vars that are neither declared nor used anywhere are flagged, but
+not removed.
+Use 'morio vars rm' to remove them.
+
+This also happens automatically when you run 'morio template'.`,
+	Example: `  morio vars prune
+  morio vars prune --dry-run`,
+	Annotations: mutating,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		declarations, err := GetVarDeclarations()
+		if err != nil {
+			return err
 		}
+		return PruneVars(declarations, dryRun)
+	},
+}
+
+// morio vars revert
+var revertCmd = &cobra.Command{
+	Use:   "revert NAME",
+	Short: "Revert a var to an earlier value",
+	Long: `Reverts template variable (var) NAME to an earlier value.
+
+Without --to, this undoes the last change to NAME.
+With --to, this restores the value NAME had at that time.
+Use 'morio vars history NAME' to see the available timestamps.
+
+The revert itself is journaled too, so you can revert a revert.`,
+	Example: `  morio vars revert WARP_DRIVE
+  morio vars revert WARP_DRIVE --to 2025-02-10T14:03:12Z`,
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, _ := cmd.Flags().GetString("to")
+		return RevertVar(args[0], to)
 	},
 }
 
@@ -159,9 +363,10 @@ the default value.
 If you want the variable gone altogether, use 'morio vars clear' to
 set the var to an empty string. Note that you cannot remove default variables,
 but you can override them.`,
-	Args: cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		RmVar(args[0])
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return RmVar(args[0])
 	},
 }
 
@@ -170,97 +375,181 @@ var setCmd = &cobra.Command{
 	Use:   "set NAME value",
 	Short: "Set the value of a var",
 	Long: `Stores a new value for a template variable,
-This will always write a custom template variable.`,
-	Example: "  morio vars set WARP_DRIVE 9",
-	Args:    cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		SetVar(args[0], args[1])
+This will always write a custom template variable.
+
+If a template declares the type of the var (or other constraints
+like enum, pattern, min, or max) in its moriodata, the value must
+match the declaration or it will be rejected.
+
+List and map values can be given as YAML or JSON, and are stored as
+JSON. With --append or --remove, the value is added to or removed
+from the current list instead.
+
+Vars that are declared as type secret (or set with --secret) are
+stored encrypted, and only decrypted by 'morio template'.`,
+	Example: `  morio vars set WARP_DRIVE 9
+  morio vars set NGINX_LOG_PATHS '[ /var/log/nginx/access.log, /var/log/nginx/error.log ]'
+  morio vars set NGINX_LOG_PATHS --append /var/log/nginx/other.log
+  morio vars set --secret DB_PASSWORD hunter2`,
+	Annotations: mutating,
+	Args:        cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkVarName(args[0]); err != nil {
+			return err
+		}
+		secret, _ := cmd.Flags().GetBool("secret")
+		appendItem, _ := cmd.Flags().GetBool("append")
+		removeItem, _ := cmd.Flags().GetBool("remove")
+		if appendItem || removeItem {
+			return EditListVar(args[0], args[1], removeItem)
+		}
+		return ValidateAndSetVars(map[string]string{args[0]: args[1]}, secret)
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(varsCmd)
 	varsCmd.AddCommand(clearCmd)
+	varsCmd.AddCommand(describeCmd)
 	varsCmd.AddCommand(disableCmd)
 	varsCmd.AddCommand(enableCmd)
 	varsCmd.AddCommand(exportCmd)
 	varsCmd.AddCommand(getCmd)
+	varsCmd.AddCommand(historyCmd)
 	varsCmd.AddCommand(importCmd)
 	varsCmd.AddCommand(listCmd)
+	varsCmd.AddCommand(lockCmd)
+	varsCmd.AddCommand(pruneCmd)
+	varsCmd.AddCommand(revertCmd)
 	varsCmd.AddCommand(rmCmd)
 	varsCmd.AddCommand(setCmd)
+	varsCmd.AddCommand(unlockCmd)
+	varsCmd.PersistentFlags().BoolVar(&forceUnlock, "force-unlock", false, "allow changes to locked vars (this lifts the lock)")
+	pruneCmd.Flags().Bool("dry-run", false, "only report orphaned vars, do not remove them")
+	revertCmd.Flags().String("to", "", "restore the value at this time (RFC 3339)")
+	importCmd.Flags().String("format", "", "format of the file: json, yaml, or dotenv")
+	importCmd.Flags().Bool("dry-run", false, "show what would change, but do not change anything")
+	importCmd.Flags().Bool("replace", false, "remove custom vars that are not in the file")
+	setCmd.Flags().Bool("secret", false, "store the value encrypted")
+	setCmd.Flags().Bool("append", false, "add the value to a list var")
+	setCmd.Flags().Bool("remove", false, "remove the value from a list var")
+	setCmd.MarkFlagsMutuallyExclusive("secret", "append", "remove")
+	listCmd.Flags().Bool("show-source", false, "show where each value comes from")
 }
 
-// Location of the variables files
-const CustomVarFolder string = "/etc/morio/vars.d"
-const DefaultVarFolder string = "/etc/morio/default.vars.d"
+// Location of the custom variables files
+func CustomVarFolder() string {
+	return GetConfigPath("vars.d")
+}
 
-// Helper for panic on error
-func check(e error) {
-	if e != nil {
-		panic(e)
-	}
+// Location of the default variables files
+func DefaultVarFolder() string {
+	return GetConfigPath("default.vars.d")
 }
 
+// Where the value of a var comes from
+const (
+	VarSourceLocked  string = "locked"
+	VarSourceEnv     string = "env"
+	VarSourceRuntime string = "runtime"
+	VarSourceFile    string = "vars file"
+	VarSourceCustom  string = "custom"
+	VarSourceProfile string = "profile"
+	VarSourceDefault string = "default"
+	VarSourceHost    string = "host fact"
+	VarSourceUnset   string = "unset"
+)
+
 // Read the value of a variable (always returns a string)
 func GetVar(key string) string {
-	// Read entire file in one gulp
-	value, err := os.ReadFile(CustomVarFolder + "/" + key)
+	value, _ := LookupVar(key)
 
-	if err != nil {
-		value, err = os.ReadFile(DefaultVarFolder + "/" + key)
-		if err != nil {
-			return ""
+	return value
+}
+
+// Read the value of a variable, along with where it was found
+// See varLayers for the order in which sources are consulted.
+func LookupVar(key string) (string, string) {
+	// Host facts are not stored on disk
+	if IsHostFact(key) {
+		value, found := GetHostFacts()[key]
+		if !found {
+			return "", VarSourceUnset
+		}
+		return value, VarSourceHost
+	}
+
+	for _, layer := range varLayers() {
+		if value, found := layer.Get(key); found {
+			return value, layer.Source
 		}
 	}
 
-	return string(value)
+	return "", VarSourceUnset
 }
 
 // Read the value of a variable
-func GetVars() map[string]string {
-	// Create the map
-	found := make(map[string]string)
+func GetVars() (map[string]string, error) {
+	vars, _, err := GetVarsWithSources()
 
-	defaults, err := ioutil.ReadDir(DefaultVarFolder)
-	check(err)
-	customs, err := ioutil.ReadDir(CustomVarFolder)
-	check(err)
+	return vars, err
+}
 
-	// Iterate over the files
-	for _, file := range defaults {
-		if !file.IsDir() {
-			name := file.Name()
-			// Skip files that start with a .
-			if len(name) > 0 && name[0] != '.' {
-				found[name] = GetVar(name)
+// Read the value of all variables, along with where they were found
+func GetVarsWithSources() (map[string]string, map[string]string, error) {
+	// Create the maps
+	found := make(map[string]string)
+	sources := make(map[string]string)
+
+	// Walk the layers from the lowest to the highest precedence
+	layers := varLayers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		names, err := layers[i].Names()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, name := range names {
+			if value, ok := layers[i].Get(name); ok {
+				found[name] = value
+				sources[name] = layers[i].Source
 			}
 		}
 	}
-	for _, file := range customs {
+
+	return found, sources, nil
+}
+
+// Lists the names of the vars stored in a folder
+func ListVarNames(folder string) ([]string, error) {
+	var names []string
+	files, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, ConfigError(err, "unable to read vars from %s", folder)
+	}
+
+	// Iterate over the files
+	for _, file := range files {
 		if !file.IsDir() {
 			name := file.Name()
 			// Skip files that start with a .
 			if len(name) > 0 && name[0] != '.' {
-				found[name] = GetVar(name)
+				names = append(names, name)
 			}
 		}
 	}
 
-	// Let's return with the keys in alphabetic order
-	keys := make([]string, 0, len(found))
-	orderedVars := make(map[string]string)
-	for key := range found {
+	return names, nil
+}
+
+// Returns the names of vars in alphabetical order
+func SortedVarNames(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
 
-	for _, key := range keys {
-		val := found[key]
-		orderedVars[key] = val
-	}
-
-	return orderedVars
+	return keys
 }
 
 // Takes a string and parses it as YAML
@@ -274,41 +563,107 @@ func parseYAMLValue(input string) (interface{}, error) {
 }
 
 // Write a value to a variable
-func SetVar(key string, value string) {
-	// Open file
-	file, err := os.Create(CustomVarFolder + "/" + key)
-	check(err)
-	defer file.Close()
+// Every change is journaled, so it can be reverted
+func SetVar(key string, value string) error {
+	if err := CheckVarLocks([]string{key}); err != nil {
+		return err
+	}
+	old := getCustomVar(key)
+	if old != nil && *old == value {
+		return liftVarLock(key)
+	}
+	if err := writeVarFile(filepath.Join(CustomVarFolder(), key), value); err != nil {
+		return err
+	}
+	if err := liftVarLock(key); err != nil {
+		return err
+	}
 
-	// Write value
-	_, err = file.WriteString(value)
-	check(err)
+	return JournalVarChange(key, old, &value)
+}
+
+// Read the value of a custom variable, or nil if it is not set
+func getCustomVar(key string) *string {
+	value, err := os.ReadFile(filepath.Join(CustomVarFolder(), key))
+	if err != nil {
+		return nil
+	}
+	found := string(value)
+
+	return &found
+}
+
+// Validates vars against their declarations, and only writes them if they are all valid
+// Secret vars are sealed before they are written, and so are vars that are
+// currently stored sealed, so a secret is not turned into plain text.
+func ValidateAndSetVars(vars map[string]string, secret bool) error {
+	declarations, err := GetVarDeclarations()
+	if err != nil {
+		return err
+	}
+	vars = normalizeVarValues(vars, declarations)
+	if err := ValidateVars(vars, declarations); err != nil {
+		return err
+	}
+	if err := CheckVarLocks(SortedVarNames(vars)); err != nil {
+		return err
+	}
+	for key, value := range vars {
+		current := getCustomVar(key)
+		if secret || IsSecretVar(key, declarations) || (current != nil && IsSecretValue(*current)) {
+			value, err = SealSecret(value)
+			if err != nil {
+				return err
+			}
+		}
+		if err := SetVar(key, value); err != nil {
+			return err
+		}
+		if _, source := LookupVar(key); source != VarSourceCustom {
+			fmt.Fprintf(os.Stderr, "Note: %s is overridden by a var from the %s source\n", key, source)
+		}
+	}
 
-	// Sync
-	file.Sync()
+	return nil
 }
 
 // Write a value to a default variable
-func SetDefaultVar(key string, value string) {
-	// Open file
-	file, err := os.Create(DefaultVarFolder + "/" + key)
-	check(err)
-	defer file.Close()
+func SetDefaultVar(key string, value string) error {
+	return writeVarFile(filepath.Join(DefaultVarFolder(), key), value)
+}
 
-	// Write value
-	_, err = file.WriteString(value)
-	check(err)
+// Write a value to a variable file
+// The file is replaced atomically, so readers never see a partial value.
+func writeVarFile(path string, value string) error {
+	if err := WriteFileAtomic(path, []byte(value), 0644); err != nil {
+		return GenericError(err, "unable to write var")
+	}
 
-	// Sync
-	file.Sync()
+	return nil
 }
 
 // Remove a (custom) variable
-func RmVar(key string) {
+// Every change is journaled, so it can be reverted
+func RmVar(key string) error {
+	if err := checkVarName(key); err != nil {
+		return err
+	}
+	if err := CheckVarLocks([]string{key}); err != nil {
+		return err
+	}
+	old := getCustomVar(key)
 	// Remove file
-	err := os.Remove(CustomVarFolder + "/" + key)
+	err := os.Remove(filepath.Join(CustomVarFolder(), key))
 	// Swallow errors if the file does not exist
-	if err != nil && !strings.Contains(err.Error(), "no such file or directory") {
-		check(err)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return GenericError(err, "unable to remove var")
 	}
+	if err := liftVarLock(key); err != nil {
+		return err
+	}
+	if old == nil {
+		return nil
+	}
+
+	return JournalVarChange(key, old, nil)
 }
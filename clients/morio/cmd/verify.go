@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// morio verify
+var verifyCmd = &cobra.Command{
+	Use:   "verify [agent]...",
+	Short: "Check the configuration against what was templated out",
+	Long: `Checks the configuration of the agents against the manifest that
+'morio template' writes, to find hand edits.
+
+Files are reported as:
+  modified   the file differs from what was rendered
+  missing    the file was rendered, but no longer exists
+  unmanaged  the file is in a folder that morio manages, but was not rendered
+
+Without arguments, all agents are checked. The exit code is 9 when files
+differ from the manifest, and 2 when an agent has no manifest because it
+was never templated out.`,
+	Example: `  morio verify
+  morio verify logs --format json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			return GenericError(nil, "unsupported format '%s', use text or json", format)
+		}
+		return VerifyConfig(args, format)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().String("format", "text", "output format, text or json")
+}
+
+// How a file differs from the manifest
+const (
+	DriftModified  string = "modified"
+	DriftMissing   string = "missing"
+	DriftUnmanaged string = "unmanaged"
+)
+
+// A file that differs from the manifest
+type driftFinding struct {
+	Agent  string `json:"agent"`
+	File   string `json:"file"`
+	Status string `json:"status"`
+	Source string `json:"source,omitempty"`
+}
+
+// The outcome of 'morio verify'
+type verifyReport struct {
+	Files      int            `json:"files"`
+	Unrendered []string       `json:"unrendered"`
+	Findings   []driftFinding `json:"findings"`
+}
+
+// Checks the configuration of the agents against their manifest
+func VerifyConfig(agents []string, format string) error {
+	if len(agents) == 0 {
+		agents = []string{"audit", "metrics", "logs"}
+	}
+	report := verifyReport{Unrendered: []string{}, Findings: []driftFinding{}}
+	for _, agent := range agents {
+		if !isAgent(agent) {
+			return GenericError(nil, "unknown agent %s, use one of audit, logs, or metrics", agent)
+		}
+		manifest, err := ReadManifest(agent)
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			report.Unrendered = append(report.Unrendered, agent)
+			continue
+		}
+		findings, err := verifyAgentConfig(manifest)
+		if err != nil {
+			return err
+		}
+		report.Files += len(manifest.Files)
+		report.Findings = append(report.Findings, findings...)
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return GenericError(err, "unable to serialize the report")
+		}
+		fmt.Println(string(data))
+	} else {
+		printVerifyReport(report)
+	}
+
+	if len(report.Findings) > 0 {
+		return ChangesError(nil, "%d file(s) differ from what 'morio template' rendered", len(report.Findings))
+	}
+	if len(report.Unrendered) > 0 {
+		return ConfigError(nil, "no manifest for %d agent(s), run 'morio template' first", len(report.Unrendered))
+	}
+
+	return nil
+}
+
+// Compares the configuration of an agent to its manifest
+func verifyAgentConfig(manifest *renderManifest) ([]driftFinding, error) {
+	var findings []driftFinding
+	rendered := make(map[string]bool)
+	for _, file := range manifest.Files {
+		rendered[file.Path] = true
+		content, exists, err := readConfigFile(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			findings = append(findings, driftFinding{Agent: manifest.Agent, File: GetConfigPath(file.Path), Status: DriftMissing, Source: GetConfigPath(file.Source)})
+		} else if sha256Hex(content) != file.Hash {
+			findings = append(findings, driftFinding{Agent: manifest.Agent, File: GetConfigPath(file.Path), Status: DriftModified, Source: GetConfigPath(file.Source)})
+		}
+	}
+
+	for _, target := range renderTargets {
+		if target.Agent != manifest.Agent || !target.Folder {
+			continue
+		}
+		if _, err := os.Stat(GetConfigPath(target.To)); err != nil {
+			continue
+		}
+		files, err := RenderedFileList(target.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !rendered[target.To+"/"+file] {
+				findings = append(findings, driftFinding{Agent: manifest.Agent, File: GetConfigPath(target.To, file), Status: DriftUnmanaged})
+			}
+		}
+	}
+
+	return findings, nil
+}
+
+// Prints the outcome of 'morio verify' as text
+func printVerifyReport(report verifyReport) {
+	for _, agent := range report.Unrendered {
+		fmt.Printf("# %s\n  no manifest, run 'morio template' first\n", agent)
+	}
+	agent := ""
+	for _, finding := range report.Findings {
+		if finding.Agent != agent {
+			agent = finding.Agent
+			fmt.Printf("# %s\n", agent)
+		}
+		if finding.Source != "" {
+			fmt.Printf("  %-9s %s (rendered from %s)\n", finding.Status, finding.File, finding.Source)
+		} else {
+			fmt.Printf("  %-9s %s\n", finding.Status, finding.File)
+		}
+	}
+	if len(report.Findings) == 0 && len(report.Unrendered) == 0 {
+		fmt.Printf("All %d rendered file(s) match the manifest\n", report.Files)
+	}
+}